@@ -0,0 +1,187 @@
+package polluter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// conflictField is the top level key of the document
+// which defines conflict handling per table.
+const conflictField = "_conflict"
+
+// Conflict defines how SQL engines handle
+// records which already exist in a table.
+type Conflict int
+
+const (
+	// ConflictError fails on duplicate keys.
+	ConflictError Conflict = iota
+	// ConflictSkip keeps existing records.
+	ConflictSkip
+	// ConflictUpdate overwrites existing records.
+	ConflictUpdate
+)
+
+var conflictNames = map[string]Conflict{
+	"error":  ConflictError,
+	"skip":   ConflictSkip,
+	"update": ConflictUpdate,
+}
+
+// OnConflict option sets how SQL engines handle
+// records which already exist. It's overridden
+// for tables listed in the _conflict key of the
+// document:
+//
+//	_conflict:
+//	  roles: skip
+//	  users:
+//	    strategy: update
+//	    target: [email]
+//
+// Target columns are introspected primary keys
+// of the table if not given.
+func OnConflict(c Conflict) SQLOption {
+	return func(o *sqlOptions) {
+		o.conflict = c
+	}
+}
+
+// conflictOption is conflict handling of the table.
+type conflictOption struct {
+	strategy Conflict
+	target   []string
+}
+
+// parseConflicts reads conflict handling of
+// tables from the _conflict key of the document.
+func parseConflicts(obj jwalk.ObjectWalker) (map[string]conflictOption, error) {
+	conflicts := make(map[string]conflictOption)
+
+	err := obj.Walk(func(key string, value interface{}) error {
+		if key != conflictField {
+			return nil
+		}
+
+		tables, ok := value.(jwalk.ObjectWalker)
+		if !ok {
+			return errors.Errorf("%s must be an object", conflictField)
+		}
+
+		return tables.Walk(func(table string, value interface{}) error {
+			c, err := parseConflict(value)
+			if err != nil {
+				return errors.Wrapf(err, "%s.%s", conflictField, table)
+			}
+			conflicts[table] = c
+			return nil
+		})
+	})
+
+	return conflicts, err
+}
+
+func parseConflict(value interface{}) (conflictOption, error) {
+	var c conflictOption
+
+	switch v := value.(type) {
+	case jwalk.Value:
+		strategy, ok := conflictNames[v.String()]
+		if !ok {
+			return c, errors.Errorf("unknown strategy %q", v.String())
+		}
+		c.strategy = strategy
+	case jwalk.ObjectWalker:
+		if err := v.Walk(func(name string, value interface{}) error {
+			s, ok := value.(jwalk.Value)
+			if !ok {
+				return errors.Errorf("%s must be a value", name)
+			}
+
+			switch name {
+			case "strategy":
+				strategy, ok := conflictNames[s.String()]
+				if !ok {
+					return errors.Errorf("unknown strategy %q", s.String())
+				}
+				c.strategy = strategy
+			case "target":
+				switch t := s.Interface().(type) {
+				case string:
+					c.target = []string{t}
+				case []interface{}:
+					for _, column := range t {
+						column, ok := column.(string)
+						if !ok {
+							return errors.New("target must be a list of columns")
+						}
+						c.target = append(c.target, column)
+					}
+				default:
+					return errors.New("target must be a list of columns")
+				}
+			default:
+				return errors.Errorf("unknown key %s", name)
+			}
+			return nil
+		}); err != nil {
+			return c, err
+		}
+	default:
+		return c, errors.New("must be a strategy or an object")
+	}
+
+	return c, nil
+}
+
+// onConflictClause returns ON CONFLICT clause used by
+// Postgres and SQLite, labelled records are updated
+// on conflict instead of skipped so RETURNING clause
+// returns existing record.
+func onConflictClause(d dialect, c conflictOption, columns []string, labelled bool) (string, error) {
+	target := make([]string, len(c.target))
+	targets := make(map[string]bool)
+	for i, column := range c.target {
+		target[i] = d.quote(column)
+		targets[column] = true
+	}
+
+	set := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if targets[column] {
+			continue
+		}
+		set = append(set, fmt.Sprintf("%s = excluded.%s", d.quote(column), d.quote(column)))
+	}
+
+	strategy := c.strategy
+	if strategy == ConflictUpdate && len(set) == 0 {
+		strategy = ConflictSkip
+	}
+	if strategy == ConflictSkip && labelled && len(target) > 0 {
+		strategy = ConflictUpdate
+		set = []string{fmt.Sprintf("%s = excluded.%s", target[0], target[0])}
+	}
+
+	switch strategy {
+	case ConflictSkip:
+		if len(target) == 0 {
+			return " ON CONFLICT DO NOTHING", nil
+		}
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(target, ", ")), nil
+	case ConflictUpdate:
+		if len(target) == 0 {
+			return "", errors.New("conflict target is required")
+		}
+		return fmt.Sprintf(
+			" ON CONFLICT (%s) DO UPDATE SET %s",
+			strings.Join(target, ", "),
+			strings.Join(set, ", "),
+		), nil
+	}
+
+	return "", nil
+}
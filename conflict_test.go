@@ -0,0 +1,220 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expect  map[string]conflictOption
+		wantErr bool
+	}{
+		{
+			name:  "valid input",
+			input: `{"_conflict":{"roles":"skip","users":{"strategy":"update","target":["email"]},"groups":{"strategy":"update","target":"name"}}}`,
+			expect: map[string]conflictOption{
+				"roles":  {strategy: ConflictSkip},
+				"users":  {strategy: ConflictUpdate, target: []string{"email"}},
+				"groups": {strategy: ConflictUpdate, target: []string{"name"}},
+			},
+		},
+		{
+			name:    "unknown strategy",
+			input:   `{"_conflict":{"roles":"replace"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid target",
+			input:   `{"_conflict":{"roles":{"strategy":"update","target":[1]}}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := parseConflicts(obj)
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+// primaryKeyDialect returns the primary
+// key without querying a database.
+type primaryKeyDialect struct {
+	dialect
+	key []string
+}
+
+func (d primaryKeyDialect) primaryKey(string) ([]string, error) {
+	return d.key, nil
+}
+
+func Test_conflictClauses(t *testing.T) {
+	const conflictInput = `_conflict:
+  roles:
+    strategy: skip
+    target: [id]
+  users:
+    strategy: update
+    target: [id]
+roles:
+- _ref: admin
+  id: 1
+  name: Admin
+users:
+- id: 1
+  name: Roman
+`
+
+	tests := []struct {
+		name    string
+		dialect dialect
+		options []SQLOption
+		expect  []string
+	}{
+		{
+			name:    "postgres",
+			dialect: postgresEngine{},
+			options: []SQLOption{KeepSequences},
+			expect: []string{
+				`INSERT INTO "roles" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "id" = excluded."id" RETURNING *;`,
+				`INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name";`,
+			},
+		},
+		{
+			name:    "mysql",
+			dialect: primaryKeyDialect{mysqlEngine{}, []string{"id"}},
+			options: []SQLOption{KeepSequences},
+			expect: []string{
+				"INSERT IGNORE INTO `roles` (`id`, `name`) VALUES (?, ?);",
+				"INSERT INTO `users` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`), `name` = VALUES(`name`);",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := yamlParser{}.Parse(strings.NewReader(conflictInput))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := buildInserts(tt.dialect, newSQLOptions(tt.options), obj)
+			assert.Nil(t, err)
+
+			queries := make([]string, len(got))
+			for i, cmd := range got {
+				queries[i] = cmd.Query
+			}
+			assert.Equal(t, tt.expect, queries)
+		})
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	if _, err := db.Exec(`CREATE TABLE accounts (id integer PRIMARY KEY, name text NOT NULL, role_id integer)`); err != nil {
+		t.Fatalf("create table: %s", err)
+	}
+
+	const seed = `roles:
+- _ref: admin
+  id: 1
+  name: Admin
+accounts:
+- id: 1
+  name: Roman
+  role_id: {$ref: admin.id}
+`
+	err := New(SQLiteEngine(db)).Pollute(strings.NewReader(seed))
+	assert.Nil(t, err)
+
+	err = New(SQLiteEngine(db)).Pollute(strings.NewReader(seed))
+	assert.NotNil(t, err, "duplicate key should fail by default")
+
+	err = New(SQLiteEngine(db, OnConflict(ConflictSkip))).Pollute(strings.NewReader(strings.Replace(seed, "Roman", "Dmitry", 1)))
+	assert.Nil(t, err)
+
+	var name string
+	err = db.QueryRow(`SELECT name FROM accounts WHERE id = 1`).Scan(&name)
+	assert.Nil(t, err)
+	assert.Equal(t, "Roman", name)
+
+	err = New(SQLiteEngine(db, OnConflict(ConflictUpdate))).Pollute(strings.NewReader(strings.Replace(seed, "Roman", "Dmitry", 1)))
+	assert.Nil(t, err)
+
+	err = db.QueryRow(`SELECT name FROM accounts WHERE id = 1`).Scan(&name)
+	assert.Nil(t, err)
+	assert.Equal(t, "Dmitry", name)
+}
+
+func TestOnConflict_labelled(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	if _, err := db.Exec(`CREATE TABLE teams (id integer PRIMARY KEY AUTOINCREMENT, name text NOT NULL UNIQUE)`); err != nil {
+		t.Fatalf("create table: %s", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE members (name text NOT NULL, team_id integer)`); err != nil {
+		t.Fatalf("create table: %s", err)
+	}
+
+	const seed = `_conflict:
+  teams:
+    strategy: skip
+    target: [name]
+roles:
+- name: Admin
+- name: User
+teams:
+- _ref: core
+  name: Core
+members:
+- name: Roman
+  team_id: {$ref: core.id}
+`
+	p := New(SQLiteEngine(db))
+	for i := 0; i < 2; i++ {
+		err := p.Pollute(strings.NewReader(seed))
+		assert.Nil(t, err)
+	}
+
+	rows, err := db.Query(`SELECT team_id FROM members`)
+	if err != nil {
+		t.Fatalf("select members: %s", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		assert.Nil(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int64{1, 1}, ids)
+}
@@ -0,0 +1,126 @@
+package polluter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Constraints defines how SQL engines check
+// foreign keys while records are inserted.
+type Constraints int
+
+const (
+	// ConstraintsImmediate checks constraints
+	// as records are inserted.
+	ConstraintsImmediate Constraints = iota
+	// ConstraintsDeferred checks deferrable constraints
+	// when the load is done with SET CONSTRAINTS ALL
+	// DEFERRED for Postgres, it's the same as
+	// ConstraintsDisabled for MySQL.
+	ConstraintsDeferred
+	// ConstraintsDisabled skips checks of foreign keys
+	// with session_replication_role set to replica for
+	// Postgres, which requires superuser, and
+	// FOREIGN_KEY_CHECKS set to 0 for MySQL.
+	ConstraintsDisabled
+)
+
+// RelaxConstraints option makes SQL engines insert
+// records with constraints relaxed, so records are
+// able to refer to each other in a cycle. Settings
+// are restored when records are inserted, before
+// the transaction is committed. SQLite engine defers
+// foreign keys for both modes.
+func RelaxConstraints(c Constraints) SQLOption {
+	return func(o *sqlOptions) {
+		o.constraints = c
+	}
+}
+
+// ValidateConstraints option makes SQL engines check
+// all foreign keys of the schema after the load
+// and fail if any of them is violated.
+func ValidateConstraints(o *sqlOptions) {
+	o.validate = true
+}
+
+// foreignKey is a foreign key constraint of the schema.
+type foreignKey struct {
+	name       string
+	table      string
+	columns    []string
+	refTable   string
+	refColumns []string
+}
+
+// orphanQuery returns the query which selects a
+// record of the table with no referenced record.
+func (fk foreignKey) orphanQuery(d dialect) string {
+	notNull := make([]string, len(fk.columns))
+	match := make([]string, len(fk.columns))
+	for i := range fk.columns {
+		notNull[i] = fmt.Sprintf("c.%s IS NOT NULL", d.quote(fk.columns[i]))
+		match[i] = fmt.Sprintf("p.%s = c.%s", d.quote(fk.refColumns[i]), d.quote(fk.columns[i]))
+	}
+
+	return fmt.Sprintf(
+		"SELECT 1 FROM %s c WHERE %s AND NOT EXISTS (SELECT 1 FROM %s p WHERE %s) LIMIT 1",
+		d.quote(fk.table),
+		strings.Join(notNull, " AND "),
+		d.quote(fk.refTable),
+		strings.Join(match, " AND "),
+	)
+}
+
+// checkOrphans fails if any of the foreign
+// keys has a record with no referenced record.
+func checkOrphans(ctx context.Context, d dialect, conn SQLConn, fks []foreignKey) error {
+	for _, fk := range fks {
+		rows, err := conn.QueryContext(ctx, fk.orphanQuery(d))
+		if err != nil {
+			return errors.Wrapf(err, "check %s", fk.name)
+		}
+		found := rows.Next()
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return errors.Wrapf(err, "check %s", fk.name)
+		}
+		if found {
+			return errors.Errorf("foreign key %s of %s is violated", fk.name, fk.table)
+		}
+	}
+
+	return nil
+}
+
+// queryForeignKeyColumns reads foreign keys, the query
+// returns name of the constraint, table, column,
+// referenced table and column ordered by constraints.
+func queryForeignKeyColumns(ctx context.Context, conn SQLConn, q string) ([]foreignKey, error) {
+	rows, err := conn.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fks := make([]foreignKey, 0)
+	for rows.Next() {
+		var name, table, column, refTable, refColumn string
+		if err := rows.Scan(&name, &table, &column, &refTable, &refColumn); err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		if n := len(fks); n == 0 || fks[n-1].name != name || fks[n-1].table != table {
+			fks = append(fks, foreignKey{name: name, table: table, refTable: refTable})
+		}
+		fk := &fks[len(fks)-1]
+		fk.columns = append(fk.columns, column)
+		fk.refColumns = append(fk.refColumns, refColumn)
+	}
+
+	return fks, rows.Err()
+}
@@ -0,0 +1,111 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_foreignKey_orphanQuery(t *testing.T) {
+	fk := foreignKey{
+		name:       "users_role_fk",
+		table:      "users",
+		columns:    []string{"role_id", "group_id"},
+		refTable:   "roles",
+		refColumns: []string{"id", "group_id"},
+	}
+
+	got := fk.orphanQuery(postgresEngine{})
+	assert.Equal(t, `SELECT 1 FROM "users" c WHERE c."role_id" IS NOT NULL AND c."group_id" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "roles" p WHERE p."id" = c."role_id" AND p."group_id" = c."group_id") LIMIT 1`, got)
+}
+
+func Test_buildInserts_constraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		options []SQLOption
+		expect  []string
+	}{
+		{
+			name:    "postgres deferred",
+			dialect: postgresEngine{},
+			options: []SQLOption{RelaxConstraints(ConstraintsDeferred), KeepSequences},
+			expect: []string{
+				"SET CONSTRAINTS ALL DEFERRED;",
+				`INSERT INTO "users" ("id") VALUES ($1);`,
+				"SET CONSTRAINTS ALL IMMEDIATE;",
+			},
+		},
+		{
+			name:    "postgres disabled",
+			dialect: postgresEngine{},
+			options: []SQLOption{RelaxConstraints(ConstraintsDisabled), KeepSequences},
+			expect: []string{
+				"SET session_replication_role = replica;",
+				`INSERT INTO "users" ("id") VALUES ($1);`,
+				"RESET session_replication_role;",
+			},
+		},
+		{
+			name:    "mysql",
+			dialect: mysqlEngine{},
+			options: []SQLOption{RelaxConstraints(ConstraintsDisabled)},
+			expect: []string{
+				"SET @polluter_foreign_key_checks = @@FOREIGN_KEY_CHECKS;",
+				"SET FOREIGN_KEY_CHECKS = 0;",
+				"INSERT INTO `users` (`id`) VALUES (?);",
+				"SET FOREIGN_KEY_CHECKS = @polluter_foreign_key_checks, @polluter_foreign_key_checks = NULL;",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(strings.NewReader(`{"users":[{"id":1}]}`))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := buildInserts(tt.dialect, newSQLOptions(tt.options), obj)
+			assert.Nil(t, err)
+
+			queries := make([]string, len(got))
+			for i, cmd := range got {
+				queries[i] = cmd.Query
+			}
+			assert.Equal(t, tt.expect, queries)
+		})
+	}
+}
+
+func TestRelaxConstraints(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	const seed = `users:
+- id: 1
+  name: Roman
+  role_id: 1
+roles:
+- id: 1
+  name: Admin
+`
+	err := New(SQLiteEngine(db, ValidateConstraints)).Pollute(strings.NewReader("users:\n- id: 1\n  name: Roman\n  role_id: 5\n"))
+	assert.EqualError(t, err, "exec failed: validate constraints: foreign key 0 of users is violated")
+	assert.Equal(t, 0, countRows(t, db, "users"))
+
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON`); err != nil {
+		t.Fatalf("enable foreign keys: %s", err)
+	}
+
+	err = New(SQLiteEngine(db)).Pollute(strings.NewReader(seed))
+	assert.NotNil(t, err, "foreign key should fail in document order")
+
+	err = New(SQLiteEngine(db, RelaxConstraints(ConstraintsDeferred), ValidateConstraints)).Pollute(strings.NewReader(seed))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "users"))
+}
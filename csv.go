@@ -0,0 +1,216 @@
+package polluter
+
+import (
+	"encoding/csv"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// CSVOption defines options of CSV parser.
+type CSVOption func(*csvOptions)
+
+type csvOptions struct {
+	table string
+	comma rune
+	null  *string
+}
+
+// CSVTable option sets the table records of the
+// input are seeded to. Without it files, like
+// *os.File input or files of the file system,
+// are seeded to tables named by the file without
+// the extension, other input fails.
+func CSVTable(name string) CSVOption {
+	return func(o *csvOptions) {
+		o.table = name
+	}
+}
+
+// CSVComma option sets the field
+// delimiter, it's comma by default.
+func CSVComma(r rune) CSVOption {
+	return func(o *csvOptions) {
+		o.comma = r
+	}
+}
+
+// CSVNull option sets the value of cells which
+// are seeded as NULL, CSVNull("") makes empty
+// cells NULL. Empty cells of typed columns
+// other than string are always NULL.
+func CSVNull(s string) CSVOption {
+	return func(o *csvOptions) {
+		o.null = &s
+	}
+}
+
+// CSVParser option enambles CSV parsing engine
+// for seeding. The header row gives columns,
+// annotated with types after a colon:
+//
+//	id:int,name,score:float,active:bool,born:time,meta:json,role_id:ref
+//
+// Columns without types are strings, time
+// columns are RFC 3339 times or dates and ref
+// columns refer to labelled records with
+// label.column values.
+func CSVParser(options ...CSVOption) Option {
+	o := csvOptions{comma: ','}
+	for i := range options {
+		options[i](&o)
+	}
+
+	return func(p *Polluter) {
+		p.parser = csvParser{o}
+	}
+}
+
+type csvParser struct {
+	options csvOptions
+}
+
+// csvColumn is the column of the header.
+type csvColumn struct {
+	name string
+	typ  string
+}
+
+// csvTypes are types of columns
+// the header is able to annotate.
+var csvTypes = map[string]bool{
+	"string": true,
+	"int":    true,
+	"float":  true,
+	"bool":   true,
+	"time":   true,
+	"json":   true,
+	"ref":    true,
+}
+
+func (p csvParser) Parse(r io.Reader) (jwalk.ObjectWalker, error) {
+	if p.options.table == "" {
+		return nil, errors.New("table isn't set, use CSVTable option")
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comma = p.options.comma
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("header is missing")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse")
+	}
+	// spreadsheets often start files with the byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns, err := parseCSVHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(docObjects, 0)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse")
+		}
+
+		rec := make(docObject, 0, len(columns))
+		for i, c := range columns {
+			v, err := p.value(c, row[i])
+			if err != nil {
+				line, col := cr.FieldPos(i)
+				return nil, errors.Wrapf(err, "line %d, column %d: %s", line, col, c.name)
+			}
+			rec = append(rec, docField{c.name, v})
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) == 0 {
+		return docObject{{p.options.table, docValue{[]interface{}{}}}}, nil
+	}
+	return docObject{{p.options.table, records}}, nil
+}
+
+func parseCSVHeader(header []string) ([]csvColumn, error) {
+	columns := make([]csvColumn, len(header))
+	seen := make(map[string]bool)
+	for i, h := range header {
+		c := csvColumn{name: h, typ: "string"}
+		if j := strings.LastIndex(h, ":"); j >= 0 {
+			c.name, c.typ = h[:j], h[j+1:]
+		}
+
+		switch {
+		case c.name == "":
+			return nil, errors.Errorf("column %d has no name", i+1)
+		case !csvTypes[c.typ]:
+			return nil, errors.Errorf("unknown type %q of column %s", c.typ, c.name)
+		case seen[c.name]:
+			return nil, errors.Errorf("duplicate column %s", c.name)
+		}
+		seen[c.name] = true
+		columns[i] = c
+	}
+
+	return columns, nil
+}
+
+// value converts the cell to the value of the column type.
+func (p csvParser) value(c csvColumn, s string) (interface{}, error) {
+	if p.options.null != nil && s == *p.options.null {
+		return docValue{nil}, nil
+	}
+	if s == "" && c.typ != "string" {
+		return docValue{nil}, nil
+	}
+
+	switch c.typ {
+	case "int":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return docValue{i}, err
+	case "float":
+		f, err := strconv.ParseFloat(s, 64)
+		return docValue{f}, err
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		return docValue{b}, err
+	case "time":
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return docValue{t}, nil
+			}
+		}
+		return nil, errors.Errorf("invalid time %q", s)
+	case "json":
+		v, err := decodeJSON([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid json")
+		}
+		return walkable(v), nil
+	case "ref":
+		return docObject{{refKey, docValue{s}}}, nil
+	}
+
+	return docValue{s}, nil
+}
+
+// forFile returns the parser seeding
+// the file to the table named by it.
+func (p csvParser) forFile(name string) csvParser {
+	base := path.Base(name)
+	p.options.table = strings.TrimSuffix(base, path.Ext(base))
+	return p
+}
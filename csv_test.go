@@ -0,0 +1,171 @@
+package polluter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/romanyx/jwalk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_csvParser_parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []CSVOption
+		input   string
+		expect  string
+		wantErr string
+	}{
+		{
+			name:    "typed columns",
+			options: []CSVOption{CSVTable("users")},
+			input: "\ufeffid:int,name,score:float,active:bool,meta:json,role_id:ref,_ref\n" +
+				"1,Roman,1.5,true,\"{\"\"tags\"\":[\"\"a\"\"]}\",admin.id,roman\n" +
+				"2,,,,,,\n",
+			expect: `{"users":[{"id":1,"name":"Roman","score":1.5,"active":true,"meta":{"tags":["a"]},"role_id":{"$ref":"admin.id"},"_ref":"roman"},{"id":2,"name":"","score":null,"active":null,"meta":null,"role_id":null,"_ref":""}]}`,
+		},
+		{
+			name:    "null",
+			options: []CSVOption{CSVTable("users"), CSVNull(""), CSVComma(';')},
+			input:   "id:int;name;email\n1;;\\N\n",
+			expect:  `{"users":[{"id":1,"name":null,"email":"\\N"}]}`,
+		},
+		{
+			name:    "null marker",
+			options: []CSVOption{CSVTable("users"), CSVNull(`\N`)},
+			input:   "id:int,name,email\n1,,\\N\n",
+			expect:  `{"users":[{"id":1,"name":"","email":null}]}`,
+		},
+		{
+			name:    "no records",
+			options: []CSVOption{CSVTable("users")},
+			input:   "id,name\n",
+			expect:  `{"users":[]}`,
+		},
+		{
+			name:    "no table",
+			input:   "id,name\n",
+			wantErr: "table isn't set",
+		},
+		{
+			name:    "no header",
+			options: []CSVOption{CSVTable("users")},
+			input:   "",
+			wantErr: "header is missing",
+		},
+		{
+			name:    "unknown type",
+			options: []CSVOption{CSVTable("users")},
+			input:   "id:integer\n1\n",
+			wantErr: `unknown type "integer" of column id`,
+		},
+		{
+			name:    "duplicate column",
+			options: []CSVOption{CSVTable("users")},
+			input:   "id,id:int\n1,1\n",
+			wantErr: "duplicate column id",
+		},
+		{
+			name:    "invalid value",
+			options: []CSVOption{CSVTable("users")},
+			input:   "name,id:int\nRoman,1\nDmitry,two\n",
+			wantErr: "line 3, column 8: id",
+		},
+		{
+			name:    "invalid row",
+			options: []CSVOption{CSVTable("users")},
+			input:   "id,name\n1\n",
+			wantErr: "wrong number of fields",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var p Polluter
+			CSVParser(tt.options...)(&p)
+
+			obj, err := p.parser.Parse(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+
+			got, err := obj.MarshalJSON()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(got))
+		})
+	}
+}
+
+func Test_csvParser_time(t *testing.T) {
+	obj, err := csvParser{csvOptions{table: "users", comma: ','}}.Parse(strings.NewReader("created_at:time,born:time\n2019-01-02T03:04:05Z,1990-05-06\n"))
+	assert.Nil(t, err)
+
+	var got []interface{}
+	err = WalkRecords(obj, func(rec Record) error {
+		for _, f := range rec.Fields {
+			got = append(got, f.Value.(jwalk.Value).Interface())
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		time.Date(1990, 5, 6, 0, 0, 0, 0, time.UTC),
+	}, got)
+}
+
+func TestCSVParser(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	fsys := fstest.MapFS{
+		ManifestFile: {Data: []byte("roles.csv\nusers.csv\n")},
+		"roles.csv":  {Data: []byte("_ref,name\nadmin,Admin\n")},
+		"users.csv":  {Data: []byte("id:int,name,meta,role_id:ref\n1,Roman,,admin.id\n2,Dmitry,\\N,\n")},
+	}
+
+	err := New(SQLiteEngine(db), CSVParser(CSVNull(`\N`))).PolluteFS(fsys)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "roles"))
+	assert.Equal(t, 2, countRows(t, db, "users"))
+
+	var nulls, empty, refs int
+	err = db.QueryRow(`SELECT
+		count(*) FILTER (WHERE meta IS NULL),
+		count(*) FILTER (WHERE meta = ''),
+		count(*) FILTER (WHERE role_id = (SELECT id FROM roles WHERE name = 'Admin'))
+	FROM users`).Scan(&nulls, &empty, &refs)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 1, 1}, []int{nulls, empty, refs})
+
+	name := filepath.Join(t.TempDir(), "roles.csv")
+	if err := ioutil.WriteFile(name, []byte("name\nUser\n"), 0600); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("open file: %s", err)
+	}
+	defer f.Close()
+
+	err = New(SQLiteEngine(db), CSVParser()).Pollute(f)
+	assert.Nil(t, err, "file should be seeded to the table named by it")
+	assert.Equal(t, 2, countRows(t, db, "roles"))
+
+	err = New(SQLiteEngine(db), CSVParser()).Pollute(strings.NewReader("name\nGuest\n"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "table isn't set")
+	}
+}
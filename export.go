@@ -0,0 +1,314 @@
+package polluter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Source selects records to export. Name is a table
+// for SQL engines or a key pattern for Redis engine.
+// Where is an optional condition of SQL engines
+// with placeholders for Args.
+type Source struct {
+	Name  string
+	Where string
+	Args  []interface{}
+}
+
+// Document is an ordered set of keys and values.
+// Values are nil, bool, int64, float64, string,
+// time.Time, []byte, []interface{} or Document.
+type Document []KeyValue
+
+// KeyValue is a single key of the document.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Exporter is implemented by engines which are
+// able to read records of a database back into
+// the document Polluter is able to seed.
+type Exporter interface {
+	Export(context.Context, []Source) (Document, error)
+}
+
+// Encoder is implemented by parsers which are able
+// to write the document in the format they parse.
+type Encoder interface {
+	Encode(io.Writer, Document) error
+}
+
+// Export writes records of the sources to the writer
+// in the format of the parser, so they are able to be
+// seeded with the same Polluter later.
+func (p *Polluter) Export(w io.Writer, sources ...Source) error {
+	return p.ExportContext(context.Background(), w, sources...)
+}
+
+// ExportContext is like Export but stops reading
+// records when the context is done.
+func (p *Polluter) ExportContext(ctx context.Context, w io.Writer, sources ...Source) error {
+	e, ok := p.engine.(Exporter)
+	if !ok {
+		return errors.Wrap(ErrNotSupported, "export")
+	}
+	enc, ok := p.parser.(Encoder)
+	if !ok {
+		return errors.Wrap(ErrNotSupported, "encode")
+	}
+
+	doc, err := e.Export(ctx, sources)
+	if err != nil {
+		return contextError(ctx, errors.Wrap(err, "export failed"))
+	}
+
+	return errors.Wrap(enc.Encode(w, doc), "encode failed")
+}
+
+// exportSQL reads records of the tables, ordered by
+// primary keys or by all columns of tables without
+// the primary key. Columns with JSON types are
+// decoded as nested values.
+func exportSQL(ctx context.Context, d dialect, conn SQLConn, sources []Source) (Document, error) {
+	if conn == nil {
+		return nil, errors.New("database isn't set")
+	}
+
+	doc := make(Document, 0, len(sources))
+	for _, s := range sources {
+		records, err := exportTable(ctx, d, conn, s)
+		if err != nil {
+			return nil, errors.Wrap(err, s.Name)
+		}
+		doc = append(doc, KeyValue{s.Name, records})
+	}
+
+	return doc, nil
+}
+
+func exportTable(ctx context.Context, d dialect, conn SQLConn, s Source) ([]interface{}, error) {
+	q := fmt.Sprintf("SELECT * FROM %s", d.quote(s.Name))
+	if s.Where != "" {
+		q += " WHERE " + s.Where
+	}
+
+	pk, err := d.primaryKey(s.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "primary key")
+	}
+	if len(pk) == 0 {
+		if pk, err = tableColumns(ctx, d, conn, s.Name); err != nil {
+			return nil, errors.Wrap(err, "columns")
+		}
+	}
+	if len(pk) > 0 {
+		for i := range pk {
+			pk[i] = d.quote(pk[i])
+		}
+		q += " ORDER BY " + strings.Join(pk, ", ")
+	}
+
+	rows, err := conn.QueryContext(ctx, q, s.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.Wrap(err, "columns")
+	}
+
+	records := make([]interface{}, 0)
+	for rows.Next() {
+		dest := make([]interface{}, len(types))
+		for i := range dest {
+			dest[i] = new(interface{})
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		rec := make(Document, len(types))
+		for i, t := range types {
+			v, err := exportValue(*(dest[i].(*interface{})), t.DatabaseTypeName())
+			if err != nil {
+				return nil, errors.Wrap(err, t.Name())
+			}
+			rec[i] = KeyValue{t.Name(), v}
+		}
+		records = append(records, rec)
+	}
+
+	return records, rows.Err()
+}
+
+// tableColumns returns names of columns of the table.
+func tableColumns(ctx context.Context, d dialect, conn SQLConn, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", d.quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return rows.Columns()
+}
+
+// exportKinds are kinds of values of column types,
+// which MySQL returns as text.
+var exportKinds = map[string]string{
+	"TINYINT":   "int",
+	"SMALLINT":  "int",
+	"MEDIUMINT": "int",
+	"INT":       "int",
+	"INTEGER":   "int",
+	"BIGINT":    "int",
+	"YEAR":      "int",
+	"INT2":      "int",
+	"INT4":      "int",
+	"INT8":      "int",
+	"FLOAT":     "float",
+	"DOUBLE":    "float",
+	"REAL":      "float",
+	"FLOAT4":    "float",
+	"FLOAT8":    "float",
+	"DECIMAL":   "decimal",
+	"NUMERIC":   "decimal",
+	"DATE":      "time",
+	"DATETIME":  "time",
+	"TIMESTAMP": "time",
+	"JSON":      "json",
+	"JSONB":     "json",
+}
+
+// exportValue converts text returned as bytes to
+// strings, decodes values of JSON columns and
+// converts text of numeric and time columns to
+// numbers and times, so exports of engines match.
+// Decimals which don't fit float64 keep the text.
+func exportValue(v interface{}, typ string) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		if !utf8.Valid(b) {
+			return b, nil
+		}
+		v = string(b)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+
+	typ = strings.TrimPrefix(strings.ToUpper(typ), "UNSIGNED ")
+	if i := strings.Index(typ, "("); i >= 0 {
+		typ = strings.TrimSpace(typ[:i])
+	}
+	switch exportKinds[typ] {
+	case "json":
+		return decodeJSON([]byte(s))
+	case "int":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return u, nil
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	case "decimal":
+		if f, err := strconv.ParseFloat(s, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == trimDecimal(s) {
+			return f, nil
+		}
+	case "time":
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return s, nil
+}
+
+// trimDecimal removes trailing zeros of the fraction.
+func trimDecimal(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// decodeJSON decodes JSON data keeping the order of
+// object keys, integers are decoded as int64.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after value")
+	}
+
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	case json.Delim:
+		switch t {
+		case '{':
+			doc := make(Document, 0)
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				doc = append(doc, KeyValue{k.(string), v})
+			}
+			_, err := dec.Token()
+			return doc, err
+		case '[':
+			items := make([]interface{}, 0)
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, v)
+			}
+			_, err := dec.Token()
+			return items, err
+		}
+		return nil, errors.Errorf("unexpected %s", t)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,204 @@
+package polluter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_decodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expect  interface{}
+		wantErr bool
+	}{
+		{
+			name:  "object",
+			input: `{"b":1,"a":[1.5,"x",null,{"c":false}]}`,
+			expect: Document{
+				{"b", int64(1)},
+				{"a", []interface{}{1.5, "x", nil, Document{{"c", false}}}},
+			},
+		},
+		{
+			name:   "scalar",
+			input:  `"value"`,
+			expect: "value",
+		},
+		{
+			name:    "trailing data",
+			input:   `{} {}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			input:   `value`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := decodeJSON([]byte(tt.input))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_exportValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		typ    string
+		expect interface{}
+	}{
+		{
+			name:   "mysql integer",
+			value:  []byte("42"),
+			typ:    "BIGINT",
+			expect: int64(42),
+		},
+		{
+			name:   "mysql unsigned integer",
+			value:  []byte("18446744073709551615"),
+			typ:    "UNSIGNED BIGINT",
+			expect: uint64(18446744073709551615),
+		},
+		{
+			name:   "mysql float",
+			value:  []byte("0.5"),
+			typ:    "DOUBLE",
+			expect: 0.5,
+		},
+		{
+			name:   "mysql decimal",
+			value:  []byte("10.50"),
+			typ:    "DECIMAL",
+			expect: 10.5,
+		},
+		{
+			name:   "postgres decimal out of float range",
+			value:  []byte("12345678901234567890.123"),
+			typ:    "NUMERIC",
+			expect: "12345678901234567890.123",
+		},
+		{
+			name:   "mysql datetime",
+			value:  []byte("2019-01-02 03:04:05"),
+			typ:    "DATETIME",
+			expect: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			name:   "sqlite declared type",
+			value:  "7",
+			typ:    "int(11)",
+			expect: int64(7),
+		},
+		{
+			name:   "text of integer column",
+			value:  "seven",
+			typ:    "INTEGER",
+			expect: "seven",
+		},
+		{
+			name:   "json",
+			value:  []byte(`{"key":1}`),
+			typ:    "JSON",
+			expect: Document{{"key", int64(1)}},
+		},
+		{
+			name:   "binary",
+			value:  []byte{0xff},
+			typ:    "BLOB",
+			expect: []byte{0xff},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := exportValue(tt.value, tt.typ)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	const seed = `roles:
+- id: 1
+  name: Admin
+- id: 2
+  name: User
+users:
+- id: 2
+  name: Dmitry
+  meta: '{"key":"value"}'
+  role_id: 2
+- id: 1
+  name: Roman
+  role_id: 1
+`
+	err := New(SQLiteEngine(db)).Pollute(strings.NewReader(seed))
+	assert.Nil(t, err)
+
+	sources := []Source{
+		{Name: "roles", Where: "name = ?", Args: []interface{}{"Admin"}},
+		{Name: "users"},
+		{Name: "all"},
+	}
+
+	buf := new(bytes.Buffer)
+	err = New(SQLiteEngine(db)).Export(buf, sources...)
+	assert.Nil(t, err)
+	assert.Equal(t, `roles:
+  - id: 1
+    name: Admin
+users:
+  - id: 1
+    name: Roman
+    active: false
+    meta: null
+    role_id: 1
+  - id: 2
+    name: Dmitry
+    active: false
+    meta: '{"key":"value"}'
+    role_id: 2
+all: []
+`, buf.String())
+
+	jsonBuf := new(bytes.Buffer)
+	err = New(SQLiteEngine(db), JSONParser).Export(jsonBuf, sources[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"roles\": [\n    {\n      \"id\": 1,\n      \"name\": \"Admin\"\n    }\n  ]\n}\n", jsonBuf.String())
+
+	other, teardownOther := prepareSQLiteDB(t)
+	defer teardownOther()
+
+	err = New(SQLiteEngine(other)).Pollute(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, other, "roles"))
+	assert.Equal(t, 2, countRows(t, other, "users"))
+
+	err = New(WithEngine(engineFunc(nil))).Export(new(bytes.Buffer))
+	assert.Equal(t, ErrNotSupported, pkgerrors.Cause(err))
+}
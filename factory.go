@@ -0,0 +1,277 @@
+package polluter
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+const (
+	// countField is the number of
+	// records the factory generates.
+	countField = "_count"
+	// templateField is the record
+	// the factory generates records from.
+	templateField = "_template"
+)
+
+// factoryData is data of templates of factory fields.
+type factoryData struct {
+	// N is the number of the record, from 1.
+	N int
+}
+
+// factory generates records from the template.
+type factory struct {
+	count    int
+	template interface{}
+}
+
+// expandFactories replaces factories of the document
+// with generated records. The factory is an object
+// with _count and _template keys, given for a table or
+// as an item of its records:
+//
+//	users:
+//	  _count: 100
+//	  _template:
+//	    name: "user{{.N}}"
+//	    email: "{{email}}"
+//
+// String values of the template are executed as
+// text/template with functions of Templates option,
+// strings which are a single action keep numbers,
+// booleans and nulls.
+func expandFactories(obj jwalk.ObjectWalker, o *templateOptions) (jwalk.ObjectWalker, error) {
+	found, err := hasFactories(obj)
+	if err != nil || !found {
+		return obj, err
+	}
+
+	e := factoryExpander{
+		funcs:     o.newFuncs(),
+		templates: make(map[string]*template.Template),
+	}
+
+	expanded := make(docObject, 0)
+	if err := obj.Walk(func(key string, value interface{}) error {
+		v, err := e.expandTable(value)
+		if err != nil {
+			return errors.Wrap(err, key)
+		}
+		expanded = append(expanded, docField{key, v})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return expanded, nil
+}
+
+// FactorySeed option makes random functions of
+// factories return the same values on every run,
+// it doesn't require Templates option and takes
+// precedence over its TemplateSeed.
+func FactorySeed(seed int64) Option {
+	return func(p *Polluter) {
+		p.factorySeed = &seed
+	}
+}
+
+// hasFactories reports whether
+// the document has factories.
+func hasFactories(obj jwalk.ObjectWalker) (bool, error) {
+	var found bool
+	err := obj.Walk(func(_ string, value interface{}) error {
+		switch v := value.(type) {
+		case jwalk.ObjectWalker:
+			found = found || isFactory(v)
+		case jwalk.ObjectsWalker:
+			return v.Walk(func(obj jwalk.ObjectWalker) error {
+				found = found || isFactory(obj)
+				return nil
+			})
+		}
+		return nil
+	})
+	return found, err
+}
+
+func isFactory(obj jwalk.ObjectWalker) bool {
+	var count, tmpl bool
+	obj.Walk(func(name string, _ interface{}) error {
+		switch name {
+		case countField:
+			count = true
+		case templateField:
+			tmpl = true
+		}
+		return nil
+	})
+	return count && tmpl
+}
+
+// parseFactory reads the count and the template
+// of the factory, no other keys are allowed.
+func parseFactory(obj jwalk.ObjectWalker) (factory, error) {
+	var f factory
+	err := obj.Walk(func(name string, value interface{}) error {
+		switch name {
+		case countField:
+			v, ok := value.(jwalk.Value)
+			if !ok {
+				return errors.Errorf("%s must be a number", countField)
+			}
+			n, ok := v.Interface().(float64)
+			if i, isInt := v.Interface().(int64); isInt {
+				n, ok = float64(i), true
+			}
+			if !ok || n < 0 || n != float64(int(n)) {
+				return errors.Errorf("%s must be a non-negative integer", countField)
+			}
+			f.count = int(n)
+		case templateField:
+			if _, ok := value.(jwalk.ObjectWalker); !ok {
+				return errors.Errorf("%s must be an object", templateField)
+			}
+			var err error
+			if f.template, err = nativeValue(value); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unexpected factory key %s", name)
+		}
+		return nil
+	})
+	return f, err
+}
+
+// factoryExpander executes templates of factories
+// with the same functions, so sequences and random
+// values continue across factories.
+type factoryExpander struct {
+	funcs     template.FuncMap
+	templates map[string]*template.Template
+}
+
+// expandTable returns records of the table
+// with factories replaced by their records.
+func (e factoryExpander) expandTable(value interface{}) (interface{}, error) {
+	var records docObjects
+	switch v := value.(type) {
+	case jwalk.ObjectWalker:
+		if !isFactory(v) {
+			return value, nil
+		}
+		var err error
+		if records, err = e.records(v); err != nil {
+			return nil, err
+		}
+	case jwalk.ObjectsWalker:
+		if err := v.Walk(func(obj jwalk.ObjectWalker) error {
+			if !isFactory(obj) {
+				records = append(records, obj)
+				return nil
+			}
+
+			generated, err := e.records(obj)
+			records = append(records, generated...)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	default:
+		return value, nil
+	}
+
+	if len(records) == 0 {
+		return docValue{[]interface{}{}}, nil
+	}
+	return records, nil
+}
+
+// records returns records generated by the factory.
+func (e factoryExpander) records(obj jwalk.ObjectWalker) (docObjects, error) {
+	f, err := parseFactory(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(docObjects, 0, f.count)
+	for n := 1; n <= f.count; n++ {
+		rec, err := e.execute(f.template, factoryData{N: n})
+		if err != nil {
+			return nil, errors.Wrapf(err, "record %d", n)
+		}
+		records = append(records, walkable(rec).(docObject))
+	}
+
+	return records, nil
+}
+
+// execute returns the value with
+// templates of strings executed.
+func (e factoryExpander) execute(value interface{}, data factoryData) (interface{}, error) {
+	switch v := value.(type) {
+	case Document:
+		doc := make(Document, len(v))
+		for i, kv := range v {
+			value, err := e.execute(kv.Value, data)
+			if err != nil {
+				return nil, errors.Wrap(err, kv.Key)
+			}
+			doc[i] = KeyValue{kv.Key, value}
+		}
+		return doc, nil
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := e.execute(item, data)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	case string:
+		return e.executeString(v, data)
+	}
+
+	return value, nil
+}
+
+func (e factoryExpander) executeString(s string, data factoryData) (interface{}, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	t, ok := e.templates[s]
+	if !ok {
+		var err error
+		t, err = template.New("field").Option("missingkey=error").Funcs(e.funcs).Parse(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse")
+		}
+		e.templates[s] = t
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return nil, errors.Wrap(err, "execute")
+	}
+	out := buf.String()
+
+	if strings.HasPrefix(s, "{{") && strings.HasSuffix(s, "}}") && strings.Count(s, "{{") == 1 {
+		if v, err := decodeJSON([]byte(out)); err == nil {
+			switch v.(type) {
+			case nil, bool, int64, float64:
+				return v, nil
+			}
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expandFactories(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expect  string
+		wantErr bool
+	}{
+		{
+			name:   "no factories",
+			input:  `{"users":[{"id":1}],"_conflict":{"users":"skip"}}`,
+			expect: `{"users":[{"id":1}],"_conflict":{"users":"skip"}}`,
+		},
+		{
+			name:   "table factory",
+			input:  `{"users":{"_count":2,"_template":{"id":"{{.N}}","name":"user{{.N}}","active":"{{eq .N 1}}","role_id":1,"tags":["t{{.N}}"]}},"roles":[]}`,
+			expect: `{"users":[{"id":1,"name":"user1","active":true,"role_id":1,"tags":["t1"]},{"id":2,"name":"user2","active":false,"role_id":1,"tags":["t2"]}],"roles":[]}`,
+		},
+		{
+			name:   "records and factories",
+			input:  `{"users":[{"id":1},{"_count":0,"_template":{"id":0}},{"_count":2,"_template":{"id":"{{seq \"users\" | add 1}}"}},{"id":4}]}`,
+			expect: `{"users":[{"id":1},{"id":2},{"id":3},{"id":4}]}`,
+		},
+		{
+			name:    "invalid count",
+			input:   `{"users":{"_count":-1,"_template":{}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unexpected key",
+			input:   `{"users":{"_count":1,"_template":{},"id":1}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			input:   `{"users":{"_count":1,"_template":{"id":"{{.M}}"}}}`,
+			wantErr: true,
+		},
+	}
+
+	o := &templateOptions{}
+	TemplateFuncs(map[string]interface{}{"add": func(a, b int) int { return a + b }})(o)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := expandFactories(obj, o)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			data, err := got.MarshalJSON()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(data))
+		})
+	}
+}
+
+func Test_expandFactories_values(t *testing.T) {
+	obj, err := yamlParser{}.Parse(strings.NewReader(`users:
+  _count: 1
+  _template:
+    created_at: 2019-01-02T03:04:05Z
+    avatar: !!binary aGVsbG8=
+`))
+	assert.Nil(t, err)
+
+	got, err := expandFactories(obj, &templateOptions{})
+	assert.Nil(t, err)
+
+	users := got.(docObject)[0].value.(docObjects)
+	assert.Equal(t, docObject{
+		{"created_at", docValue{time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{"avatar", docValue{[]byte("hello")}},
+	}, users[0])
+}
+
+func TestFactories(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	err := New(SQLiteEngine(db, BatchSize(100))).Pollute(strings.NewReader(`roles:
+- _ref: admin
+  name: Admin
+users:
+  _count: 250
+  _template:
+    id: "{{.N}}"
+    name: "{{firstName}} {{.N}}"
+    role_id: {$ref: admin.id}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 250, countRows(t, db, "users"))
+
+	var name string
+	err = db.QueryRow(`SELECT name FROM users WHERE id = 250 AND role_id = 1`).Scan(&name)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(name, " 250"), name)
+
+	input := `users: {_count: 2, _template: {name: "{{uuid}}"}}`
+	p := New(SQLiteEngine(db), FactorySeed(1))
+	first, err := p.Plan(strings.NewReader(input))
+	assert.Nil(t, err)
+	second, err := p.Plan(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+}
@@ -0,0 +1,212 @@
+package polluter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// ManifestFile is the file listing documents
+// PolluteFS seeds when no patterns are given.
+const ManifestFile = "polluter.manifest"
+
+// PolluteFS seeds documents of the file system matched
+// by glob patterns. Files are parsed by extension, .json
+// with JSON parser, .yml or .yaml with YAML parser, .toml
+// with TOML parser and .csv with CSV parser seeding the
+// table named by the file, other files with the parser
+// of the Polluter. Options of CSVParser apply to .csv
+// files except for CSVTable. Matches
+// of every pattern go in lexical order, every file is
+// seeded once, also when other files include it.
+//
+// Without patterns the documents are listed in the
+// ManifestFile of the root, a path or a pattern per
+// line, lines starting with # are comments. If there
+// is no manifest, all documents of the root are seeded
+// in lexical order.
+//
+// Documents are seeded as a single document with
+// records in the order of files, so references
+// work across files and engines which implement
+// ExecerContext roll back all of them on error.
+func (p *Polluter) PolluteFS(fsys fs.FS, patterns ...string) error {
+	return p.PolluteFSContext(context.Background(), fsys, patterns...)
+}
+
+// PolluteFSContext is like PolluteFS but stops
+// reading of files and execution of commands
+// when the context is done.
+func (p *Polluter) PolluteFSContext(ctx context.Context, fsys fs.FS, patterns ...string) error {
+	obj, err := p.parseFS(ctx, fsys, patterns)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return p.pollute(ctx, obj, obj, p.track)
+}
+
+// parseFS parses files matched by patterns
+// and joins them into a single document.
+func (p *Polluter) parseFS(ctx context.Context, fsys fs.FS, patterns []string) (jwalk.ObjectWalker, error) {
+	names, err := p.listFS(fsys, patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "list files failed")
+	}
+
+	docs := make([]jwalk.ObjectWalker, 0, len(names))
+	done := make(map[string]bool)
+	for _, name := range names {
+		// The file was included by one of previous files.
+		if done[name] {
+			continue
+		}
+		done[name] = true
+
+		obj, err := p.parseFile(ctx, fsys, name)
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		obj, err = p.include(ctx, fsys, obj, name, done)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: include failed", name)
+		}
+		docs = append(docs, obj)
+	}
+
+	obj, err := joinDocuments(docs)
+	if err != nil {
+		return nil, errors.Wrap(err, "join documents failed")
+	}
+
+	return p.expand(obj)
+}
+
+// listFS returns names of files matched by
+// patterns, of the manifest or of the root.
+func (p *Polluter) listFS(fsys fs.FS, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		var err error
+		patterns, err = readManifest(fsys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if patterns == nil {
+		return p.listRoot(fsys)
+	}
+
+	names := make([]string, 0, len(patterns))
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(path.Clean(pattern), "/")
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, pattern)
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("%s: no files found", pattern)
+		}
+
+		for _, name := range matches {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// listRoot returns names of documents
+// of the root in lexical order.
+func (p *Polluter) listRoot(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isDocument(e.Name()) {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no files found")
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// isDocument reports whether the file has
+// an extension of known parsers.
+func isDocument(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".yml", ".yaml", ".toml", ".csv":
+		return true
+	}
+	return false
+}
+
+// readManifest returns patterns of the manifest,
+// nil if the file system has no manifest.
+func readManifest(fsys fs.FS) ([]string, error) {
+	data, err := fs.ReadFile(fsys, ManifestFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make([]string, 0)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, ManifestFile)
+	}
+	if len(patterns) == 0 {
+		return nil, errors.Errorf("%s: no files listed", ManifestFile)
+	}
+
+	return patterns, nil
+}
+
+// joinDocuments returns a document with keys of the
+// documents in order. Keys of tables may repeat, so
+// records are seeded in the order of documents.
+func joinDocuments(docs []jwalk.ObjectWalker) (jwalk.ObjectWalker, error) {
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+
+	obj := make(docObject, 0)
+	for _, doc := range docs {
+		if err := doc.Walk(func(key string, value interface{}) error {
+			obj = append(obj, docField{key, value})
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
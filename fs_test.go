@@ -0,0 +1,129 @@
+package polluter
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolluter_parseFS(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		patterns []string
+		expect   string
+		wantErr  string
+	}{
+		{
+			name: "lexical order",
+			fsys: fstest.MapFS{
+				"02_users.yaml": {Data: []byte("users:\n- id: 1\n")},
+				"01_roles.json": {Data: []byte(`{"roles":[{"id":1}]}`)},
+				"03_users.yml":  {Data: []byte("users:\n- id: 2\n")},
+				"notes.txt":     {Data: []byte("skipped")},
+				"dir/04.json":   {Data: []byte(`{"skipped":[]}`)},
+			},
+			expect: `{"roles":[{"id":1}],"users":[{"id":1}],"users":[{"id":2}]}`,
+		},
+		{
+			name: "manifest",
+			fsys: fstest.MapFS{
+				ManifestFile:      {Data: []byte("# seeds\nroles.yaml\n\nusers/*.json\nroles.yaml\n")},
+				"roles.yaml":      {Data: []byte("roles:\n- id: 1\n")},
+				"users/b.json":    {Data: []byte(`{"users":[{"id":2}]}`)},
+				"users/a.json":    {Data: []byte(`{"users":[{"id":1}]}`)},
+				"ignored.yaml":    {Data: []byte("ignored: []\n")},
+				"users/base.yaml": {Data: []byte("ignored: []\n")},
+			},
+			expect: `{"roles":[{"id":1}],"users":[{"id":1}],"users":[{"id":2}]}`,
+		},
+		{
+			name: "patterns",
+			fsys: fstest.MapFS{
+				ManifestFile:        {Data: []byte("missing.yaml\n")},
+				"a.yaml":            {Data: []byte("_include: shared/roles.yaml\nusers:\n- id: 1\n")},
+				"b.yaml":            {Data: []byte("users:\n  _count: 2\n  _template:\n    id: \"{{.N}}\"\n")},
+				"shared/roles.yaml": {Data: []byte("roles:\n- id: 1\n")},
+			},
+			patterns: []string{"b.yaml", "/a.yaml"},
+			expect:   `{"users":[{"id":1},{"id":2}],"roles":[{"id":1}],"users":[{"id":1}]}`,
+		},
+		{
+			name: "shared includes",
+			fsys: fstest.MapFS{
+				"a.yaml":    {Data: []byte("_include: base.yaml\nusers:\n- id: 1\n")},
+				"b.yaml":    {Data: []byte("_include: [base.yaml, c.yaml]\nusers:\n- id: 2\n")},
+				"base.yaml": {Data: []byte("roles:\n- id: 1\n")},
+				"c.yaml":    {Data: []byte("users:\n- id: 3\n")},
+			},
+			expect: `{"roles":[{"id":1}],"users":[{"id":1}],"users":[{"id":3},{"id":2}]}`,
+		},
+		{
+			name:    "empty manifest",
+			fsys:    fstest.MapFS{ManifestFile: {Data: []byte("# nothing\n")}},
+			wantErr: "no files listed",
+		},
+		{
+			name:    "no documents",
+			fsys:    fstest.MapFS{"notes.txt": {Data: []byte("skipped")}},
+			wantErr: "no files found",
+		},
+		{
+			name:     "no matches",
+			fsys:     fstest.MapFS{"a.yaml": {Data: []byte("users: []\n")}},
+			patterns: []string{"*.json"},
+			wantErr:  "*.json: no files found",
+		},
+		{
+			name:    "invalid document",
+			fsys:    fstest.MapFS{"a.yaml": {Data: []byte("users: [\n")}},
+			wantErr: "a.yaml: parse failed",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := New().parseFS(context.Background(), tt.fsys, tt.patterns)
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+
+			data, err := obj.MarshalJSON()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(data))
+		})
+	}
+}
+
+func TestPolluter_PolluteFS(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	p := New(SQLiteEngine(db))
+
+	err := p.PolluteFS(fstest.MapFS{
+		"01_roles.yaml": {Data: []byte("roles:\n- _ref: admin\n  name: Admin\n")},
+		"02_users.yaml": {Data: []byte("users:\n- id: 1\n  name: Roman\n  role_id: {$ref: admin.id}\n")},
+		"03_users.json": {Data: []byte(`{"users":[{"id":2,"name":"Dmitry"}]}`)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "roles"))
+	assert.Equal(t, 2, countRows(t, db, "users"))
+
+	err = p.PolluteFS(fstest.MapFS{
+		"01_roles.yaml": {Data: []byte("roles:\n- name: User\n")},
+		"02_users.yaml": {Data: []byte("users:\n- id: 3\n")},
+	})
+	assert.NotNil(t, err, "record without required field should fail")
+	assert.Equal(t, 1, countRows(t, db, "roles"), "records of all files should be rolled back")
+	assert.Equal(t, 2, countRows(t, db, "users"))
+}
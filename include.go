@@ -0,0 +1,456 @@
+package polluter
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// includeField is the top level key of the
+// document which lists included documents.
+const includeField = "_include"
+
+// IncludeFS option sets the file system documents
+// listed in the _include key of the input are read
+// from:
+//
+//	_include:
+//	- base.yaml
+//	- scenarios/*.yaml
+//
+// Paths and glob patterns are relative to the
+// including document, or to the root of the file
+// system for the input. Files are parsed by
+// extension, .json with JSON parser, .yml or .yaml
+// with YAML parser, .toml with TOML parser and .csv
+// with CSV parser seeding the table named by the
+// file, other files with the parser of the Polluter.
+//
+// Included documents are merged in the given order,
+// glob matches in lexical order, and the including
+// document goes last. Records of the same table are
+// appended, tables keep the position they first
+// appear at. Records with the same _ref label or the
+// same values of the _conflict target of the table
+// are merged, fields of the later record override
+// fields of the earlier one, which keeps its position.
+// Tables of the later documents override other values,
+// directives are merged by keys. Every file is
+// included once, cycles are reported as an error.
+func IncludeFS(fsys fs.FS) Option {
+	return func(p *Polluter) {
+		p.fsys = fsys
+	}
+}
+
+// include returns the document merged with the
+// documents it includes from the file system, name
+// is the path of the document, empty for the input.
+// Files in done are skipped, included files are
+// added to it.
+func (p *Polluter) include(ctx context.Context, fsys fs.FS, obj jwalk.ObjectWalker, name string, done map[string]bool) (jwalk.ObjectWalker, error) {
+	found, err := hasInclude(obj)
+	if err != nil || !found {
+		return obj, err
+	}
+
+	m := newDocumentMerger()
+	i := includer{
+		p:     p,
+		ctx:   ctx,
+		fsys:  fsys,
+		m:     m,
+		stack: make([]string, 0),
+		done:  done,
+	}
+	if name != "" {
+		i.stack = append(i.stack, name)
+	}
+	if err := i.merge(obj, name); err != nil {
+		return nil, err
+	}
+
+	return mergeTables(m.document())
+}
+
+func hasInclude(obj jwalk.ObjectWalker) (bool, error) {
+	var found bool
+	err := obj.Walk(func(key string, _ interface{}) error {
+		found = found || key == includeField
+		return nil
+	})
+	return found, err
+}
+
+// includer merges included documents depth first.
+type includer struct {
+	p     *Polluter
+	ctx   context.Context
+	fsys  fs.FS
+	m     *documentMerger
+	stack []string
+	done  map[string]bool
+}
+
+// merge merges documents included by the document
+// and then the document itself.
+func (i *includer) merge(obj jwalk.ObjectWalker, name string) error {
+	names, err := i.includes(obj, name)
+	if err != nil {
+		return err
+	}
+
+	for _, included := range names {
+		if err := i.mergeFile(included); err != nil {
+			return err
+		}
+	}
+
+	return obj.Walk(func(key string, value interface{}) error {
+		if key == includeField {
+			return nil
+		}
+		return i.m.add(key, value)
+	})
+}
+
+func (i *includer) mergeFile(name string) error {
+	for j, s := range i.stack {
+		if s == name {
+			cycle := append(append([]string{}, i.stack[j:]...), name)
+			return errors.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if i.done[name] {
+		return nil
+	}
+	i.done[name] = true
+
+	obj, err := i.p.parseFile(i.ctx, i.fsys, name)
+	if err != nil {
+		return errors.Wrap(err, name)
+	}
+
+	i.stack = append(i.stack, name)
+	if err := i.merge(obj, name); err != nil {
+		return err
+	}
+	i.stack = i.stack[:len(i.stack)-1]
+
+	return nil
+}
+
+// includes returns paths of files included by the
+// document, patterns are relative to the document.
+func (i *includer) includes(obj jwalk.ObjectWalker, name string) ([]string, error) {
+	var patterns []string
+	if err := obj.Walk(func(key string, value interface{}) error {
+		if key != includeField {
+			return nil
+		}
+
+		v, ok := value.(jwalk.Value)
+		if !ok {
+			return errors.Errorf("%s must be a path or a list of paths", includeField)
+		}
+		switch items := v.Interface().(type) {
+		case string:
+			patterns = append(patterns, items)
+		case []interface{}:
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return errors.Errorf("%s must be a path or a list of paths", includeField)
+				}
+				patterns = append(patterns, s)
+			}
+		default:
+			return errors.Errorf("%s must be a path or a list of paths", includeField)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	if i.fsys == nil {
+		return nil, errors.Errorf("%s requires IncludeFS option", includeField)
+	}
+
+	dir := "."
+	if name != "" {
+		dir = path.Dir(name)
+	}
+
+	names := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !path.IsAbs(pattern) {
+			pattern = path.Join(dir, pattern)
+		}
+		pattern = strings.TrimPrefix(path.Clean(pattern), "/")
+
+		matches, err := fs.Glob(i.fsys, pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "include %s", pattern)
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("include %s: no files found", pattern)
+		}
+		names = append(names, matches...)
+	}
+
+	return names, nil
+}
+
+// parseFile parses the file of the file system
+// with the parser chosen by its extension.
+func (p *Polluter) parseFile(ctx context.Context, fsys fs.FS, name string) (jwalk.ObjectWalker, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return p.parseInput(ctx, f, p.parserFor(name))
+}
+
+// parserFor returns the parser for the extension
+// of the file or the parser of the Polluter.
+func (p *Polluter) parserFor(name string) Parser {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return jsonParser{}
+	case ".yml", ".yaml":
+		return yamlParser{}
+	case ".toml":
+		return tomlParser{}
+	case ".csv":
+		c, ok := p.parser.(csvParser)
+		if !ok {
+			c = csvParser{csvOptions{comma: ','}}
+		}
+		return c.forFile(name)
+	}
+	return p.parser
+}
+
+// documentMerger merges top level keys of documents.
+type documentMerger struct {
+	keys   []string
+	values map[string]*mergedValue
+}
+
+// mergedValue is either records of the table,
+// fields of the directive or a single value.
+type mergedValue struct {
+	table   bool
+	records docObjects
+	fields  *documentMerger
+	value   interface{}
+}
+
+func newDocumentMerger() *documentMerger {
+	return &documentMerger{
+		values: make(map[string]*mergedValue),
+	}
+}
+
+func (m *documentMerger) add(key string, value interface{}) error {
+	v, ok := m.values[key]
+	if !ok {
+		v = new(mergedValue)
+		m.values[key] = v
+		m.keys = append(m.keys, key)
+	}
+
+	switch val := value.(type) {
+	case jwalk.ObjectsWalker:
+		if !v.table {
+			*v = mergedValue{table: true}
+		}
+		return val.Walk(func(obj jwalk.ObjectWalker) error {
+			v.records = append(v.records, obj)
+			return nil
+		})
+	case jwalk.ObjectWalker:
+		switch {
+		case isFactory(val):
+			if !v.table {
+				*v = mergedValue{table: true}
+			}
+			v.records = append(v.records, val)
+			return nil
+		case directives[key]:
+			if v.fields == nil {
+				*v = mergedValue{fields: newDocumentMerger()}
+			}
+			return val.Walk(func(name string, value interface{}) error {
+				return v.fields.replace(name, value)
+			})
+		}
+	case jwalk.Value:
+		if items, ok := val.Interface().([]interface{}); ok && len(items) == 0 {
+			if !v.table {
+				*v = mergedValue{table: true}
+			}
+			return nil
+		}
+	}
+
+	return m.replace(key, value)
+}
+
+// replace sets the value of the key
+// keeping its position.
+func (m *documentMerger) replace(key string, value interface{}) error {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = &mergedValue{value: value}
+	return nil
+}
+
+// document returns the merged document.
+func (m *documentMerger) document() docObject {
+	obj := make(docObject, 0, len(m.keys))
+	for _, key := range m.keys {
+		v := m.values[key]
+		switch {
+		case v.table:
+			if len(v.records) == 0 {
+				obj = append(obj, docField{key, docValue{[]interface{}{}}})
+				continue
+			}
+			obj = append(obj, docField{key, v.records})
+		case v.fields != nil:
+			obj = append(obj, docField{key, v.fields.document()})
+		default:
+			obj = append(obj, docField{key, v.value})
+		}
+	}
+
+	return obj
+}
+
+// mergeTables merges records of tables of the document
+// given with the same label or conflict target values.
+func mergeTables(obj docObject) (docObject, error) {
+	conflicts, err := parseConflicts(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, f := range obj {
+		records, ok := f.value.(docObjects)
+		if !ok {
+			continue
+		}
+		if obj[i].value, err = mergeRecords(records, conflicts[f.name].target); err != nil {
+			return nil, errors.Wrap(err, f.name)
+		}
+	}
+
+	return obj, nil
+}
+
+// mergeRecords merges records with the same label or
+// the same values of the target, factories are kept.
+func mergeRecords(records docObjects, target []string) (docObjects, error) {
+	merged := make(docObjects, 0, len(records))
+	index := make(map[string]int)
+	for _, obj := range records {
+		if isFactory(obj) {
+			merged = append(merged, obj)
+			continue
+		}
+
+		keys, err := recordKeys(obj, target)
+		if err != nil {
+			return nil, err
+		}
+
+		i := -1
+		for _, key := range keys {
+			if j, ok := index[key]; ok {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			i = len(merged)
+			merged = append(merged, obj)
+		} else if merged[i], err = mergeFields(merged[i], obj); err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			index[key] = i
+		}
+	}
+
+	return merged, nil
+}
+
+// recordKeys returns keys the record is matched
+// by: its label and values of the target.
+func recordKeys(obj jwalk.ObjectWalker, target []string) ([]string, error) {
+	keys := make([]string, 0, 2)
+	values := make(map[string][]byte, len(target))
+	if err := obj.Walk(func(name string, value interface{}) error {
+		if name == labelField {
+			v, ok := value.(jwalk.Value)
+			if !ok {
+				return errors.Errorf("%s must be a string", labelField)
+			}
+			keys = append(keys, labelField+" "+v.String())
+			return nil
+		}
+
+		for _, column := range target {
+			if column != name {
+				continue
+			}
+			m, ok := value.(json.Marshaler)
+			if !ok {
+				return nil
+			}
+			data, err := m.MarshalJSON()
+			if err != nil {
+				return errors.Wrap(err, name)
+			}
+			values[name] = data
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(target) > 0 && len(values) == len(target) {
+		parts := make([]string, len(target))
+		for i, column := range target {
+			parts[i] = string(values[column])
+		}
+		keys = append(keys, "target "+strings.Join(parts, ","))
+	}
+
+	return keys, nil
+}
+
+// mergeFields returns fields of the record
+// overridden by fields of the later one.
+func mergeFields(obj, later jwalk.ObjectWalker) (jwalk.ObjectWalker, error) {
+	m := newDocumentMerger()
+	for _, o := range []jwalk.ObjectWalker{obj, later} {
+		if err := o.Walk(m.replace); err != nil {
+			return nil, err
+		}
+	}
+	return m.document(), nil
+}
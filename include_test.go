@@ -0,0 +1,146 @@
+package polluter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolluter_include(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.yaml": {Data: []byte(`roles:
+- id: 1
+  name: Admin
+_conflict:
+  roles: skip
+  users: error
+`)},
+		"scenarios/users.json":  {Data: []byte(`{"_include":"../base.yaml","users":[{"id":1}]}`)},
+		"scenarios/extra.yaml":  {Data: []byte("users:\n- id: 2\nroles: []\n")},
+		"cycle/a.yaml":          {Data: []byte("_include: b.yaml\n")},
+		"cycle/b.yaml":          {Data: []byte("_include: [/cycle/a.yaml]\n")},
+		"factories/users.yaml":  {Data: []byte("users:\n  _count: 1\n  _template:\n    id: 10\n")},
+		"labels/base.yaml":      {Data: []byte("roles:\n- _ref: admin\n  name: Admin\n  active: true\n- _ref: user\n  name: User\n")},
+		"invalid/include.yaml":  {Data: []byte("_include: {a: b}\n")},
+		"invalid/document.yaml": {Data: []byte("users: [\n")},
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		expect  string
+		wantErr string
+	}{
+		{
+			name:   "no includes",
+			input:  `{"users":[{"id":1}]}`,
+			expect: `{"users":[{"id":1}]}`,
+		},
+		{
+			name:   "merge order",
+			input:  `{"_include":["base.yaml","scenarios/*"],"users":[{"id":3}],"_conflict":{"users":"update"},"key":"value"}`,
+			expect: `{"roles":[{"id":1,"name":"Admin"}],"_conflict":{"roles":"skip","users":"update"},"users":[{"id":2},{"id":1},{"id":3}],"key":"value"}`,
+		},
+		{
+			name:   "factories",
+			input:  `{"_include":"factories/users.yaml","users":[{"id":1}]}`,
+			expect: `{"users":[{"_count":1,"_template":{"id":10}},{"id":1}]}`,
+		},
+		{
+			name:   "override by label",
+			input:  `{"_include":"labels/base.yaml","roles":[{"_ref":"admin","name":"Root"},{"_ref":"guest"}]}`,
+			expect: `{"roles":[{"_ref":"admin","name":"Root","active":true},{"_ref":"user","name":"User"},{"_ref":"guest"}]}`,
+		},
+		{
+			name:   "override by conflict target",
+			input:  `{"_include":"base.yaml","_conflict":{"roles":{"strategy":"update","target":["id"]}},"roles":[{"id":1,"name":"Root"},{"id":2}]}`,
+			expect: `{"roles":[{"id":1,"name":"Root"},{"id":2}],"_conflict":{"roles":{"strategy":"update","target":["id"]},"users":"error"}}`,
+		},
+		{
+			name:    "cycle",
+			input:   `{"_include":"cycle/a.yaml"}`,
+			wantErr: "include cycle: cycle/a.yaml -> cycle/b.yaml -> cycle/a.yaml",
+		},
+		{
+			name:    "no files",
+			input:   `{"_include":"missing/*.yaml"}`,
+			wantErr: "include missing/*.yaml: no files found",
+		},
+		{
+			name:    "invalid include",
+			input:   `{"_include":"invalid/include.yaml"}`,
+			wantErr: "_include must be a path or a list of paths",
+		},
+		{
+			name:    "invalid document",
+			input:   `{"_include":"invalid/document.yaml"}`,
+			wantErr: "invalid/document.yaml: parse failed",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := New(IncludeFS(fsys))
+			obj, err := jsonParser{}.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := p.include(context.Background(), p.fsys, obj, "", make(map[string]bool))
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+
+			data, err := got.MarshalJSON()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(data))
+		})
+	}
+}
+
+func TestIncludeFS(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	fsys := fstest.MapFS{
+		"base.yaml": {Data: []byte("roles:\n- _ref: admin\n  name: Admin\n")},
+	}
+
+	err := New(SQLiteEngine(db)).Pollute(strings.NewReader("_include: base.yaml\n"))
+	assert.NotNil(t, err, "include without file system should fail")
+
+	err = New(SQLiteEngine(db), IncludeFS(fsys)).Pollute(strings.NewReader(`_include: base.yaml
+users:
+- id: 1
+  name: Roman
+  role_id: {$ref: admin.id}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "roles"))
+	assert.Equal(t, 1, countRows(t, db, "users"))
+
+	err = New(SQLiteEngine(db), IncludeFS(fsys)).Pollute(strings.NewReader(`_include: base.yaml
+roles:
+- _ref: admin
+  name: Root
+users:
+- id: 2
+  name: Dmitry
+  role_id: {$ref: admin.id}
+`))
+	assert.Nil(t, err, "overridden record should be seeded once")
+	var name string
+	err = db.QueryRow(`SELECT name FROM roles WHERE id = (SELECT role_id FROM users WHERE id = 2)`).Scan(&name)
+	assert.Nil(t, err)
+	assert.Equal(t, "Root", name)
+}
@@ -0,0 +1,350 @@
+package polluter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// buildInserts builds INSERT statements for
+// records of the document.
+func buildInserts(d dialect, o sqlOptions, obj jwalk.ObjectWalker) (Commands, error) {
+	b := newInsertBuilder(d, o)
+
+	conflicts, err := parseConflicts(obj)
+	if err != nil {
+		return nil, err
+	}
+	b.conflicts = conflicts
+
+	if err := walkOrdered(d, o, obj, b.add); err != nil {
+		return nil, err
+	}
+
+	return b.flush()
+}
+
+// insertRow is a single record converted
+// to columns and arguments.
+type insertRow struct {
+	table   string
+	label   string
+	columns []string
+	args    []interface{}
+	size    int
+	// copy is set for rows loaded with COPY.
+	copy bool
+}
+
+// insertBuilder converts records to rows and
+// groups consecutive rows of the same table with
+// the same columns into multi-row INSERT commands.
+type insertBuilder struct {
+	d         dialect
+	o         sqlOptions
+	labels    map[string]bool
+	conflicts map[string]conflictOption
+	targets   map[string][]string
+	tables    []string
+	seeded    map[string]bool
+	batch     []insertRow
+	batchSize int
+	cmds      Commands
+}
+
+func newInsertBuilder(d dialect, o sqlOptions) *insertBuilder {
+	return &insertBuilder{
+		d:         d,
+		o:         o,
+		labels:    make(map[string]bool),
+		conflicts: make(map[string]conflictOption),
+		targets:   make(map[string][]string),
+		seeded:    make(map[string]bool),
+		cmds:      make(Commands, 0),
+	}
+}
+
+func (b *insertBuilder) add(rec Record) error {
+	row, err := b.row(rec)
+	if err != nil {
+		return err
+	}
+
+	if row.label != "" {
+		if b.labels[row.label] {
+			return errors.Errorf("%s: duplicate record label %s", rec.Table, row.label)
+		}
+		b.labels[row.label] = true
+	}
+
+	if !b.seeded[row.table] {
+		b.seeded[row.table] = true
+		b.tables = append(b.tables, row.table)
+	}
+
+	if !b.fits(row) {
+		if err := b.flushBatch(); err != nil {
+			return err
+		}
+	}
+	b.batch = append(b.batch, row)
+	b.batchSize += row.size
+
+	// labelled and tracked rows are inserted one
+	// by one, so their values could be fetched.
+	if row.label != "" || b.o.track || (!row.copy && b.o.batchSize <= 1) {
+		return b.flushBatch()
+	}
+
+	return nil
+}
+
+// conflict returns conflict handling of the table,
+// primary key is used as a target if it's required
+// and isn't given.
+func (b *insertBuilder) conflict(table string, labelled bool) (conflictOption, error) {
+	c, ok := b.conflicts[table]
+	if !ok {
+		c = conflictOption{strategy: b.o.conflict}
+	}
+
+	needsTarget := c.strategy == ConflictUpdate || (c.strategy == ConflictSkip && (labelled || b.o.track))
+	if len(c.target) > 0 || !needsTarget {
+		return c, nil
+	}
+
+	target, err := b.primaryKey(table)
+	if err != nil {
+		return c, err
+	}
+	c.target = target
+
+	return c, nil
+}
+
+// primaryKey returns cached primary key of the table.
+func (b *insertBuilder) primaryKey(table string) ([]string, error) {
+	target, ok := b.targets[table]
+	if !ok {
+		var err error
+		target, err = b.d.primaryKey(table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: primary key", table)
+		}
+		b.targets[table] = target
+	}
+
+	return target, nil
+}
+
+func (b *insertBuilder) row(rec Record) (insertRow, error) {
+	row := insertRow{
+		table:   rec.Table,
+		label:   rec.Label,
+		columns: make([]string, 0, len(rec.Fields)),
+		args:    make([]interface{}, 0, len(rec.Fields)),
+	}
+
+	var hasRefs bool
+	for _, f := range rec.Fields {
+		var arg interface{}
+		if ref, ok := f.Value.(Ref); ok {
+			if !b.labels[ref.Label] {
+				return row, errors.Errorf("%s.%s: reference to unknown record %s", rec.Table, f.Name, ref)
+			}
+			arg = ref
+			hasRefs = true
+		} else {
+			var err error
+			arg, err = b.d.arg(f.Value)
+			if err == errSkipField {
+				continue
+			}
+			if err != nil {
+				return row, errors.Wrapf(err, "%s.%s", rec.Table, f.Name)
+			}
+		}
+
+		row.args = append(row.args, arg)
+		row.columns = append(row.columns, f.Name)
+		row.size += argSize(arg) + len(f.Name)
+	}
+
+	_, hasConflict := b.conflicts[rec.Table]
+	row.copy = b.d.copy(rec.Table) && row.label == "" && !hasRefs && len(row.columns) > 0 &&
+		!hasConflict && b.o.conflict == ConflictError && !b.o.track
+
+	return row, nil
+}
+
+// fits reports whether the row can be
+// added to the current batch.
+func (b *insertBuilder) fits(row insertRow) bool {
+	if len(b.batch) == 0 {
+		return true
+	}
+	if row.label != "" {
+		return false
+	}
+
+	first := b.batch[0]
+	if first.table != row.table || first.copy != row.copy || !equalColumns(first.columns, row.columns) {
+		return false
+	}
+	if row.copy {
+		return true
+	}
+	if len(b.batch) >= b.o.batchSize {
+		return false
+	}
+
+	maxArgs, maxSize := b.d.limits()
+	if b.o.packetSize > 0 {
+		maxSize = b.o.packetSize
+	}
+	if maxArgs > 0 && (len(b.batch)+1)*len(row.columns) > maxArgs {
+		return false
+	}
+	if maxSize > 0 && b.batchSize+row.size > maxSize {
+		return false
+	}
+
+	return true
+}
+
+// flushBatch converts the current batch to the command.
+func (b *insertBuilder) flushBatch() error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+
+	first := b.batch[0]
+	if first.copy {
+		b.flushCopy()
+		return nil
+	}
+
+	c, err := b.conflict(first.table, first.label != "")
+	if err != nil {
+		return err
+	}
+	verb, clause, err := b.d.conflict(c, first.columns, first.label != "")
+	if err != nil {
+		return errors.Wrapf(err, "%s", first.table)
+	}
+
+	columns := make([]string, len(first.columns))
+	for i, c := range first.columns {
+		columns[i] = b.d.quote(c)
+	}
+
+	values := make([]string, 0, len(b.batch))
+	args := make([]interface{}, 0, len(b.batch)*len(columns))
+	for _, row := range b.batch {
+		placeholders := make([]string, len(row.args))
+		for i := range row.args {
+			placeholders[i] = b.d.placeholder(len(args) + i + 1)
+		}
+		args = append(args, row.args...)
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	insert := fmt.Sprintf(
+		"%s INTO %s (%s) VALUES %s%s",
+		verb,
+		b.d.quote(first.table),
+		strings.Join(columns, ", "),
+		strings.Join(values, ", "),
+		clause,
+	)
+
+	cmd := Command{Args: args}
+	if first.label != "" || b.o.track {
+		cmd.Label = first.label
+		cmd.Columns = first.columns
+		if b.d.returning() {
+			insert = insert + " RETURNING *"
+		}
+		if !b.d.returning() || b.o.track {
+			cmd.table = first.table
+			if c.strategy != ConflictError {
+				cmd.target = c.target
+			}
+			if cmd.key, err = b.primaryKey(first.table); err != nil {
+				return err
+			}
+		}
+	}
+	cmd.track = b.o.track
+	cmd.Query = insert + ";"
+
+	b.cmds = append(b.cmds, cmd)
+	b.batch = b.batch[:0]
+	b.batchSize = 0
+
+	return nil
+}
+
+// flushCopy converts the current batch to COPY command.
+func (b *insertBuilder) flushCopy() {
+	first := b.batch[0]
+	args := make([]interface{}, 0, len(b.batch)*len(first.columns))
+	for _, row := range b.batch {
+		args = append(args, row.args...)
+	}
+
+	b.cmds = append(b.cmds, Command{
+		Query:   pq.CopyIn(first.table, first.columns...),
+		Args:    args,
+		Columns: first.columns,
+	})
+	b.batch = b.batch[:0]
+	b.batchSize = 0
+}
+
+// flush returns commands built so far.
+func (b *insertBuilder) flush() (Commands, error) {
+	if err := b.flushBatch(); err != nil {
+		return nil, err
+	}
+	if !b.o.keepSequences && len(b.tables) > 0 {
+		b.cmds = append(b.cmds, b.d.syncSequences(b.tables)...)
+	}
+
+	cmds := b.cmds
+	b.cmds = make(Commands, 0)
+
+	if b.o.constraints != ConstraintsImmediate && len(cmds) > 0 {
+		relax, restore := b.d.constraints(b.o.constraints)
+		cmds = append(append(relax, cmds...), restore...)
+	}
+	return cmds, nil
+}
+
+func equalColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// argSize returns approximate size of
+// the argument in the statement.
+func argSize(arg interface{}) int {
+	switch v := arg.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	default:
+		return 8
+	}
+}
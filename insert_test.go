@@ -0,0 +1,168 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_buildInserts(t *testing.T) {
+	const batchInput = `roles:
+- _ref: admin
+  name: Admin
+- name: User
+- name: Guest
+users:
+- id: 1
+  name: Roman
+  role_id: {$ref: admin.id}
+- id: 2
+  name: Dmitry
+  role_id: {$ref: admin.id}
+- id: 3
+  name: Alex
+- id: 4
+  name: Sergey
+`
+
+	tests := []struct {
+		name    string
+		options []SQLOption
+		expect  []string
+	}{
+		{
+			name: "without batches",
+			expect: []string{
+				`INSERT INTO "roles" ("name") VALUES (?) RETURNING *;`,
+				`INSERT INTO "roles" ("name") VALUES (?);`,
+				`INSERT INTO "roles" ("name") VALUES (?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+			},
+		},
+		{
+			name:    "batches",
+			options: []SQLOption{BatchSize(100)},
+			expect: []string{
+				`INSERT INTO "roles" ("name") VALUES (?) RETURNING *;`,
+				`INSERT INTO "roles" ("name") VALUES (?), (?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?), (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?), (?, ?);`,
+			},
+		},
+		{
+			name:    "batch size",
+			options: []SQLOption{BatchSize(1)},
+			expect: []string{
+				`INSERT INTO "roles" ("name") VALUES (?) RETURNING *;`,
+				`INSERT INTO "roles" ("name") VALUES (?);`,
+				`INSERT INTO "roles" ("name") VALUES (?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+			},
+		},
+		{
+			name:    "packet size",
+			options: []SQLOption{BatchSize(100), MaxPacketSize(30)},
+			expect: []string{
+				`INSERT INTO "roles" ("name") VALUES (?) RETURNING *;`,
+				`INSERT INTO "roles" ("name") VALUES (?), (?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name", "role_id") VALUES (?, ?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+				`INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := yamlParser{}.Parse(strings.NewReader(batchInput))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := buildInserts(sqliteEngine{}, newSQLOptions(tt.options), obj)
+			assert.Nil(t, err)
+
+			queries := make([]string, len(got))
+			for i, cmd := range got {
+				queries[i] = cmd.Query
+			}
+			assert.Equal(t, tt.expect, queries)
+		})
+	}
+}
+
+func Test_buildInserts_placeholders(t *testing.T) {
+	obj, err := jsonParser{}.Parse(strings.NewReader(`{"users":[{"id":1,"name":"Roman"},{"id":2,"name":"Dmitry"}]}`))
+	if err != nil {
+		assert.Nil(t, err)
+	}
+
+	got, err := buildInserts(postgresEngine{}, newSQLOptions([]SQLOption{BatchSize(2), KeepSequences}), obj)
+	assert.Nil(t, err)
+	assert.Equal(t, Commands{
+		Command{
+			Query: `INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4);`,
+			Args:  []interface{}{float64(1), "Roman", float64(2), "Dmitry"},
+		},
+	}, got)
+}
+
+func Test_buildInserts_copy(t *testing.T) {
+	obj, err := yamlParser{}.Parse(strings.NewReader(`roles:
+- _ref: admin
+  name: Admin
+- name: User
+users:
+- id: 1
+  name: Roman
+- id: 2
+  name: Dmitry
+  role_id: {$ref: admin.id}
+- id: 3
+  name: Alex
+`))
+	if err != nil {
+		assert.Nil(t, err)
+	}
+
+	e := postgresEngine{options: newSQLOptions([]SQLOption{PostgresCopy("users"), KeepSequences})}
+	got, err := buildInserts(e, e.options, obj)
+	assert.Nil(t, err)
+	assert.Equal(t, Commands{
+		Command{
+			Query:   `INSERT INTO "roles" ("name") VALUES ($1) RETURNING *;`,
+			Args:    []interface{}{"Admin"},
+			Label:   "admin",
+			Columns: []string{"name"},
+		},
+		Command{
+			Query: `INSERT INTO "roles" ("name") VALUES ($1);`,
+			Args:  []interface{}{"User"},
+		},
+		Command{
+			Query:   `COPY "users" ("id", "name") FROM STDIN`,
+			Args:    []interface{}{int64(1), "Roman"},
+			Columns: []string{"id", "name"},
+		},
+		Command{
+			Query: `INSERT INTO "users" ("id", "name", "role_id") VALUES ($1, $2, $3);`,
+			Args:  []interface{}{int64(2), "Dmitry", Ref{"admin", "id"}},
+		},
+		Command{
+			Query:   `COPY "users" ("id", "name") FROM STDIN`,
+			Args:    []interface{}{int64(3), "Alex"},
+			Columns: []string{"id", "name"},
+		},
+	}, got)
+}
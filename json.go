@@ -1,6 +1,8 @@
 package polluter
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 
@@ -10,7 +12,7 @@ import (
 
 type jsonParser struct{}
 
-func (p jsonParser) parse(r io.Reader) (jwalk.ObjectWalker, error) {
+func (p jsonParser) Parse(r io.Reader) (jwalk.ObjectWalker, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read")
@@ -28,3 +30,62 @@ func (p jsonParser) parse(r io.Reader) (jwalk.ObjectWalker, error) {
 
 	return obj, nil
 }
+
+// Encode writes the document as indented JSON
+// keeping the order of keys.
+func (p jsonParser) Encode(w io.Writer, doc Document) error {
+	buf := new(bytes.Buffer)
+	if err := encodeJSON(buf, doc); err != nil {
+		return err
+	}
+
+	out := new(bytes.Buffer)
+	if err := json.Indent(out, buf.Bytes(), "", "  "); err != nil {
+		return errors.Wrap(err, "indent")
+	}
+	out.WriteByte('\n')
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case Document:
+		buf.WriteByte('{')
+		for i, kv := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(kv.Key)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, kv.Value); err != nil {
+				return errors.Wrap(err, kv.Key)
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+
+	return nil
+}
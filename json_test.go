@@ -1,6 +1,7 @@
 package polluter
 
 import (
+	"bytes"
 	"io"
 	"strings"
 	"testing"
@@ -42,7 +43,7 @@ func Test_jsonParser_parse(t *testing.T) {
 			t.Parallel()
 
 			s := jsonParser{}
-			_, err := s.parse(tt.arg)
+			_, err := s.Parse(tt.arg)
 
 			if tt.wantErr && err == nil {
 				assert.NotNil(t, err)
@@ -55,3 +56,34 @@ func Test_jsonParser_parse(t *testing.T) {
 		})
 	}
 }
+
+func Test_jsonParser_Encode(t *testing.T) {
+	doc := Document{
+		{"users", []interface{}{
+			Document{
+				{"id", int64(1)},
+				{"name", "Roman"},
+				{"meta", Document{{"b", true}, {"a", nil}}},
+			},
+		}},
+		{"roles", []interface{}{}},
+	}
+
+	buf := new(bytes.Buffer)
+	err := jsonParser{}.Encode(buf, doc)
+	assert.Nil(t, err)
+	assert.Equal(t, `{
+  "users": [
+    {
+      "id": 1,
+      "name": "Roman",
+      "meta": {
+        "b": true,
+        "a": null
+      }
+    }
+  ],
+  "roles": []
+}
+`, buf.String())
+}
@@ -82,6 +82,14 @@ CREATE TABLE IF NOT EXISTS users (
 	id integer NOT NULL,
 	name varchar(255) NOT NULL
 );
+CREATE TABLE IF NOT EXISTS teams (
+	id integer NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	name varchar(255) NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS members (
+	name varchar(255) NOT NULL,
+	team_id integer
+);
 `
 
 func newMySQL(pool *dockertest.Pool) (*mySQL, error) {
@@ -108,7 +116,7 @@ func newMySQL(pool *dockertest.Pool) (*mySQL, error) {
 
 	go func() {
 		if err := pool.Retry(func() error {
-			db, err = sql.Open("mysql", fmt.Sprintf("test:test@(localhost:%s)/test", res.GetPort("3306/tcp")))
+			db, err = sql.Open("mysql", fmt.Sprintf("test:test@(localhost:%s)/test?multiStatements=true", res.GetPort("3306/tcp")))
 			if err != nil {
 				return err
 			}
@@ -1,79 +1,198 @@
 package polluter
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/romanyx/jwalk"
 )
 
 type mysqlEngine struct {
-	db *sql.DB
+	db      *sql.DB
+	conn    SQLConn
+	options sqlOptions
 }
 
-func (e mysqlEngine) exec(cmds []command) error {
-	tx, err := e.db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "tx begin")
-	}
+func (e mysqlEngine) Exec(cmds []Command) error {
+	return e.ExecContext(context.Background(), cmds)
+}
+
+func (e mysqlEngine) ExecContext(ctx context.Context, cmds []Command) error {
+	return execSQL(ctx, e, e.db, e.conn, cmds)
+}
+
+func (e mysqlEngine) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	return buildInserts(e, e.options, obj)
+}
+
+func (e mysqlEngine) BuildTruncate(obj jwalk.ObjectWalker) (Commands, error) {
+	return buildTruncate(e, obj)
+}
+
+// BuildTracked builds inserts of records one by one
+// with their keys, so they're removed by cleanup.
+func (e mysqlEngine) BuildTracked(obj jwalk.ObjectWalker) (Commands, error) {
+	o := e.options
+	o.track = true
+	return buildInserts(e, o, obj)
+}
+
+func (e mysqlEngine) ExecTracked(ctx context.Context, cmds []Command) (Commands, error) {
+	return execTracked(ctx, e, e.db, e.conn, cmds)
+}
 
-	for _, c := range cmds {
-		if _, err := tx.Exec(c.q, c.args...); err != nil {
-			if rErr := tx.Rollback(); rErr != nil {
-				err = errors.Wrap(rErr, err.Error())
-			}
-			return errors.Wrap(err, "exec")
+func (e mysqlEngine) Verify(ctx context.Context, obj jwalk.ObjectWalker) (Diff, error) {
+	return verifySQL(ctx, e, sqlHandle(e.db, e.conn), obj)
+}
+
+func (e mysqlEngine) Export(ctx context.Context, sources []Source) (Document, error) {
+	return exportSQL(ctx, e, sqlHandle(e.db, e.conn), sources)
+}
+
+func (e mysqlEngine) quote(name string) string {
+	return fmt.Sprintf("`%s`", strings.Replace(name, "`", "``", -1))
+}
+
+func (e mysqlEngine) arg(value interface{}) (interface{}, error) {
+	return jsonArg(value, e.options)
+}
+
+func (e mysqlEngine) returning() bool {
+	return false
+}
+
+// limits of placeholders in prepared statement
+// and the default max_allowed_packet.
+func (e mysqlEngine) limits() (int, int) {
+	return 65535, 4 << 20
+}
+
+// conflict uses INSERT IGNORE to skip and
+// ON DUPLICATE KEY UPDATE to update records,
+// MySQL checks all unique keys, so the target
+// isn't used.
+func (e mysqlEngine) conflict(c conflictOption, columns []string, _ bool) (string, string, error) {
+	switch c.strategy {
+	case ConflictSkip:
+		return "INSERT IGNORE", "", nil
+	case ConflictUpdate:
+		if len(columns) == 0 {
+			return "INSERT IGNORE", "", nil
+		}
+		set := make([]string, len(columns))
+		for i, column := range columns {
+			set[i] = fmt.Sprintf("%s = VALUES(%s)", e.quote(column), e.quote(column))
 		}
+		return "INSERT", " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", "), nil
 	}
 
-	return errors.Wrap(tx.Commit(), "commit")
+	return "INSERT", "", nil
 }
 
-func (e mysqlEngine) build(obj jwalk.ObjectWalker) (commands, error) {
-	cmds := make(commands, 0)
+// truncate deletes records instead of TRUNCATE,
+// which commits the transaction implicitly.
+func (e mysqlEngine) truncate(tables []string) Commands {
+	cmds, restore := e.constraints(ConstraintsDisabled)
+	for _, t := range tables {
+		cmds = append(cmds, Command{Query: fmt.Sprintf("DELETE FROM %s;", e.quote(t))})
+	}
 
-	if err := obj.Walk(func(table string, value interface{}) error {
-		if v, ok := value.(jwalk.ObjectsWalker); ok {
-			if err := v.Walk(func(obj jwalk.ObjectWalker) error {
-				values := make([]interface{}, 0)
-				insert := fmt.Sprintf("INSERT INTO `%s` (", table)
-				valuesStr := "("
+	return append(cmds, restore...)
+}
 
-				first := true
-				if err := obj.Walk(func(field string, value interface{}) error {
-					if v, ok := value.(jwalk.Value); ok {
-						values = append(values, v.Interface())
+// syncSequences does nothing since InnoDB moves
+// AUTO_INCREMENT past inserted ids itself.
+func (e mysqlEngine) syncSequences(_ []string) Commands {
+	return nil
+}
 
-						if !first {
-							insert = insert + ", "
-							valuesStr = valuesStr + ", "
-						}
+func (e mysqlEngine) primaryKey(table string) ([]string, error) {
+	return queryColumns(sqlHandle(e.db, e.conn), `
+SELECT COLUMN_NAME
+FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE()
+	AND TABLE_NAME = ?
+	AND CONSTRAINT_NAME = 'PRIMARY'
+ORDER BY ORDINAL_POSITION`, table)
+}
 
-						insert = fmt.Sprintf("%s`%s`", insert, field)
-						valuesStr = valuesStr + "?"
-					}
+func (e mysqlEngine) foreignKeys() (map[string][]string, error) {
+	return queryForeignKeys(sqlHandle(e.db, e.conn), `
+SELECT DISTINCT TABLE_NAME, REFERENCED_TABLE_NAME
+FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE()
+	AND REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY 1, 2`)
+}
 
-					if first {
-						first = false
-					}
+// constraints disables foreign key checks for both
+// modes, the previous value is kept in a session
+// variable and restored after the load.
+func (e mysqlEngine) constraints(_ Constraints) (Commands, Commands) {
+	return Commands{
+			Command{Query: "SET @polluter_foreign_key_checks = @@FOREIGN_KEY_CHECKS;"},
+			Command{Query: "SET FOREIGN_KEY_CHECKS = 0;"},
+		},
+		Commands{
+			Command{Query: "SET FOREIGN_KEY_CHECKS = @polluter_foreign_key_checks, @polluter_foreign_key_checks = NULL;"},
+		}
+}
 
-					return nil
-				}); err != nil {
-					return err
-				}
+// reset restores foreign key checks, session
+// variables aren't rolled back with the transaction.
+func (e mysqlEngine) reset() Commands {
+	return Commands{
+		Command{Query: "SET FOREIGN_KEY_CHECKS = IFNULL(@polluter_foreign_key_checks, @@FOREIGN_KEY_CHECKS), @polluter_foreign_key_checks = NULL;"},
+	}
+}
 
-				insert = insert + ") VALUES " + valuesStr + ");"
-				cmds = append(cmds, command{insert, values})
-				return nil
-			}); err != nil {
-				return err
-			}
-		}
+func (e mysqlEngine) checkConstraints(ctx context.Context, conn SQLConn) error {
+	if !e.options.validate {
 		return nil
-	}); err != nil {
-		return nil, err
 	}
 
-	return cmds, nil
+	fks, err := queryForeignKeyColumns(ctx, conn, `
+SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE()
+	AND REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return errors.Wrap(err, "foreign keys")
+	}
+
+	return checkOrphans(ctx, e, conn, fks)
+}
+
+func (e mysqlEngine) Render(w io.Writer, cmds Commands) error {
+	return renderSQL(w, e, cmds)
+}
+
+// literal escapes backslashes of strings, which
+// MySQL treats as escape characters by default,
+// and formats times without time zone.
+func (e mysqlEngine) literal(arg interface{}) (string, error) {
+	if t, ok := arg.(time.Time); ok {
+		arg = t.Format("2006-01-02 15:04:05.999999")
+	}
+	return formatLiteral(arg, mysqlString)
+}
+
+var mysqlEscaper = strings.NewReplacer(`\`, `\\`, "'", "''", "\x00", `\0`)
+
+func mysqlString(s string) string {
+	return "'" + mysqlEscaper.Replace(s) + "'"
+}
+
+func (e mysqlEngine) copy(_ string) bool {
+	return false
+}
+
+func (e mysqlEngine) placeholder(_ int) string {
+	return "?"
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,34 +16,32 @@ func Test_mysqlEngine_build(t *testing.T) {
 	tests := []struct {
 		name   string
 		input  []byte
-		expect commands
+		expect Commands
 	}{
 		{
 			name:  "example input",
-			input: []byte(`{"users":[{"id":1,"name":"Roman"},{"id":2,"name":"Dmitry"}],"roles":[{"id":2,"role_ids":[1,2]}]}`),
-			expect: commands{
-				command{
-					q: "INSERT INTO `users` (`id`, `name`) VALUES (?, ?);",
-					args: []interface{}{
+			input: []byte(`{"users":[{"id":1,"name":"Roman"},{"id":2,"name":"Dmitry"}],"roles":[{"id":2,"role_ids":[1,2],"meta":{"key":"value"}}]}`),
+			expect: Commands{
+				Command{
+					Query: "INSERT INTO `users` (`id`, `name`) VALUES (?, ?);",
+					Args: []interface{}{
 						float64(1),
 						"Roman",
 					},
 				},
-				command{
-					q: "INSERT INTO `users` (`id`, `name`) VALUES (?, ?);",
-					args: []interface{}{
+				Command{
+					Query: "INSERT INTO `users` (`id`, `name`) VALUES (?, ?);",
+					Args: []interface{}{
 						float64(2),
 						"Dmitry",
 					},
 				},
-				command{
-					q: "INSERT INTO `roles` (`id`, `role_ids`) VALUES (?, ?);",
-					args: []interface{}{
+				Command{
+					Query: "INSERT INTO `roles` (`id`, `role_ids`, `meta`) VALUES (?, ?, ?);",
+					Args: []interface{}{
 						float64(2),
-						[]interface{}{
-							float64(1),
-							float64(2),
-						},
+						"[1,2]",
+						`{"key":"value"}`,
 					},
 				},
 			},
@@ -54,13 +53,13 @@ func Test_mysqlEngine_build(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			obj, err := jsonParser{}.parse(bytes.NewReader(tt.input))
+			obj, err := jsonParser{}.Parse(bytes.NewReader(tt.input))
 			if err != nil {
 				assert.Nil(t, err)
 			}
 
 			e := mysqlEngine{}
-			got, err := e.build(obj)
+			got, err := e.Build(obj)
 			assert.Nil(t, err)
 			assert.Equal(t, tt.expect, got)
 		})
@@ -74,15 +73,15 @@ func Test_mysqlEngine_exec(t *testing.T) {
 
 	tests := []struct {
 		name    string
-		args    []command
+		args    []Command
 		wantErr bool
 	}{
 		{
 			name: "valid query",
-			args: []command{
-				command{
-					q: "INSERT INTO `users` (`id`, `name`) VALUES (?, ?);",
-					args: []interface{}{
+			args: []Command{
+				Command{
+					Query: "INSERT INTO `users` (`id`, `name`) VALUES (?, ?);",
+					Args: []interface{}{
 						1,
 						"Roman",
 					},
@@ -91,10 +90,10 @@ func Test_mysqlEngine_exec(t *testing.T) {
 		},
 		{
 			name: "invalid query",
-			args: []command{
-				command{
-					q: "INSERT INTO `roles` (`id`, `name`) VALUES (?, ?);",
-					args: []interface{}{
+			args: []Command{
+				Command{
+					Query: "INSERT INTO `roles` (`id`, `name`) VALUES (?, ?);",
+					Args: []interface{}{
 						1,
 						"User",
 					},
@@ -111,9 +110,9 @@ func Test_mysqlEngine_exec(t *testing.T) {
 
 			db, teardown := prepareMySQLDB(t)
 			defer teardown()
-			e := mysqlEngine{db}
+			e := mysqlEngine{db: db}
 
-			err := e.exec(tt.args)
+			err := e.Exec(tt.args)
 
 			if tt.wantErr && err == nil {
 				assert.NotNil(t, err)
@@ -127,6 +126,93 @@ func Test_mysqlEngine_exec(t *testing.T) {
 	}
 }
 
+func Test_mysqlEngine_verify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, teardown := prepareMySQLDB(t)
+	defer teardown()
+
+	p := New(MySQLEngine(db))
+	err := p.Pollute(strings.NewReader(`teams:
+- id: 1
+  name: Core
+- id: 2
+  name: Docs
+`))
+	assert.Nil(t, err)
+
+	diff, err := p.Verify(strings.NewReader(`teams:
+- id: 1
+  name: Backend
+- id: 2
+  name: Docs
+`))
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Missing)
+	assert.Empty(t, diff.Extra)
+	if assert.Len(t, diff.Mismatched, 1) {
+		assert.Equal(t, "teams", diff.Mismatched[0].Table)
+		assert.Equal(t, []FieldDiff{{Name: "name", Expected: "Backend", Actual: "Core"}}, diff.Mismatched[0].Fields)
+	}
+}
+
+func Test_mysqlEngine_conflict(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, teardown := prepareMySQLDB(t)
+	defer teardown()
+
+	const seed = `_conflict:
+  teams:
+    strategy: skip
+    target: [name]
+teams:
+- name: Docs
+- _ref: core
+  name: Core
+members:
+- name: Roman
+  team_id: {$ref: core.id}
+`
+	p := New(MySQLEngine(db))
+	for i := 0; i < 2; i++ {
+		err := p.Pollute(strings.NewReader(seed))
+		assert.Nil(t, err)
+	}
+
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM `members` m JOIN `teams` t ON t.`id` = m.`team_id` WHERE t.`name` = 'Core'").Scan(&n)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func Test_mysqlEngine_reset(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, teardown := prepareMySQLDB(t)
+	defer teardown()
+
+	p := New(MySQLEngine(db, RelaxConstraints(ConstraintsDisabled)), Truncate)
+	err := p.Pollute(strings.NewReader(`teams:
+- id: 1
+  name: Core
+missing:
+- id: 1
+`))
+	assert.NotNil(t, err)
+
+	var checks int
+	err = db.QueryRow("SELECT @@FOREIGN_KEY_CHECKS").Scan(&checks)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, checks)
+}
+
 func prepareMySQLDB(t *testing.T) (db *sql.DB, teardown func() error) {
 	dbName := fmt.Sprintf("db_%d", time.Now().UnixNano())
 	db, err := sql.Open("mysqltx", dbName)
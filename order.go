@@ -0,0 +1,147 @@
+package polluter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// OrderTables option makes SQL engines read foreign
+// keys of the schema and insert records of tables
+// they refer to first, records of each table keep
+// the order of the document. Building fails if
+// tables of the document refer to each other in
+// a cycle.
+func OrderTables(o *sqlOptions) {
+	o.order = true
+}
+
+// walkOrdered iterates through records of the
+// document, ordered by foreign keys of the
+// tables if OrderTables option is set.
+func walkOrdered(d dialect, o sqlOptions, obj jwalk.ObjectWalker, fn func(Record) error) error {
+	if !o.order {
+		return WalkRecords(obj, fn)
+	}
+
+	names := make([]string, 0)
+	records := make(map[string][]Record)
+	if err := WalkRecords(obj, func(rec Record) error {
+		if _, ok := records[rec.Table]; !ok {
+			names = append(names, rec.Table)
+		}
+		records[rec.Table] = append(records[rec.Table], rec)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	deps, err := d.foreignKeys()
+	if err != nil {
+		return errors.Wrap(err, "foreign keys")
+	}
+
+	sorted, err := sortTables(names, deps)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range sorted {
+		for _, rec := range records[table] {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortTables orders tables so that tables are
+// preceded by tables they depend on, otherwise
+// the given order is kept. Tables which aren't
+// given and self references are ignored.
+func sortTables(tables []string, deps map[string][]string) ([]string, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	given := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		given[t] = true
+	}
+
+	state := make(map[string]int, len(tables))
+	sorted := make([]string, 0, len(tables))
+	path := make([]string, 0)
+
+	var visit func(t string) error
+	visit = func(t string) error {
+		switch state[t] {
+		case visited:
+			return nil
+		case visiting:
+			i := len(path) - 1
+			for path[i] != t {
+				i--
+			}
+			cycle := append(append([]string{}, path[i:]...), t)
+			return errors.Errorf("foreign key cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[t] = visiting
+		path = append(path, t)
+		for _, dep := range deps[t] {
+			if dep == t || !given[dep] {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[t] = visited
+		sorted = append(sorted, t)
+
+		return nil
+	}
+
+	for _, t := range tables {
+		if err := visit(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// queryForeignKeys maps tables to tables they refer
+// to, the query returns pairs of table names.
+func queryForeignKeys(conn SQLConn, q string) (map[string][]string, error) {
+	if conn == nil {
+		return nil, errors.New("database isn't set")
+	}
+
+	rows, err := conn.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := make(map[string][]string)
+	for rows.Next() {
+		var table, ref string
+		if err := rows.Scan(&table, &ref); err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+		deps[table] = append(deps[table], ref)
+	}
+
+	return deps, rows.Err()
+}
@@ -0,0 +1,99 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sortTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		tables  []string
+		deps    map[string][]string
+		expect  []string
+		wantErr string
+	}{
+		{
+			name:   "document order",
+			tables: []string{"users", "roles"},
+			expect: []string{"users", "roles"},
+		},
+		{
+			name:   "dependencies first",
+			tables: []string{"posts", "users", "roles"},
+			deps: map[string][]string{
+				"posts": {"users"},
+				"users": {"roles"},
+			},
+			expect: []string{"roles", "users", "posts"},
+		},
+		{
+			name:   "self and unknown references",
+			tables: []string{"users"},
+			deps: map[string][]string{
+				"users": {"users", "roles"},
+			},
+			expect: []string{"users"},
+		},
+		{
+			name:   "cycle",
+			tables: []string{"roles", "users", "groups"},
+			deps: map[string][]string{
+				"users":  {"groups"},
+				"groups": {"roles"},
+				"roles":  {"users"},
+			},
+			wantErr: "foreign key cycle: roles -> users -> groups -> roles",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := sortTables(tt.tables, tt.deps)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func TestOrderTables(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON`); err != nil {
+		t.Fatalf("enable foreign keys: %s", err)
+	}
+
+	const seed = `users:
+- id: 1
+  name: Roman
+  role_id: 1
+roles:
+- id: 1
+  name: Admin
+`
+	err := New(SQLiteEngine(db)).Pollute(strings.NewReader(seed))
+	assert.NotNil(t, err, "foreign key should fail in document order")
+
+	err = New(SQLiteEngine(db, OrderTables)).Pollute(strings.NewReader(seed))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "users"))
+
+	if _, err := db.Exec(`
+CREATE TABLE a (id integer PRIMARY KEY, b_id integer REFERENCES b (id));
+CREATE TABLE b (id integer PRIMARY KEY, a_id integer REFERENCES a (id));`); err != nil {
+		t.Fatalf("create tables: %s", err)
+	}
+
+	err = New(SQLiteEngine(db, OrderTables)).Pollute(strings.NewReader("a:\n- id: 1\nb:\n- id: 1\n"))
+	assert.EqualError(t, err, "build commands failed: foreign key cycle: a -> b -> a")
+}
@@ -1,8 +1,12 @@
 package polluter
 
 import (
+	"context"
 	"database/sql"
 	"io"
+	"io/fs"
+	"path/filepath"
+	"sync"
 
 	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
@@ -13,83 +17,445 @@ var (
 	// ErrEngineNotSpecified causes if no engine option was used
 	// with the factory method.
 	ErrEngineNotSpecified = errors.New("specify database engine with the factory method option")
+	// ErrNotSupported causes if the engine doesn't
+	// support the requested feature.
+	ErrNotSupported = errors.New("not supported by the engine")
 )
 
-type parser interface {
-	parse(io.Reader) (jwalk.ObjectWalker, error)
+// Parser parses input into a document
+// which is used to build commands.
+type Parser interface {
+	Parse(io.Reader) (jwalk.ObjectWalker, error)
 }
 
-type execer interface {
-	exec([]command) error
+// Execer executes commands on a database.
+type Execer interface {
+	Exec([]Command) error
 }
 
-type commands []command
+// ExecerContext is implemented by engines which
+// are able to stop execution of commands when
+// the context is done.
+type ExecerContext interface {
+	ExecContext(context.Context, []Command) error
+}
+
+// Commands is a list of commands.
+type Commands []Command
+
+// Command is a single statement for a database.
+// Query holds the statement itself and Args holds
+// its arguments, meaning of both depends on the engine.
+// Args may contain Ref values which are resolved by
+// the engine when the command is executed.
+type Command struct {
+	Query string
+	Args  []interface{}
+	// Label and Columns are set for labelled records,
+	// Columns are names of columns for Args, so the
+	// engine knows values of the record Refs point to.
+	// Columns are also set for COPY commands of Postgres
+	// engine, where Args hold values of all copied rows.
+	Label   string
+	Columns []string
+	// table, target and key are set for labelled records
+	// of engines without RETURNING clause and for tracked
+	// records. Last insert id is the value of the primary
+	// key, the record which isn't inserted because of a
+	// conflict is selected by the conflict target and
+	// tracked records are removed by the primary key.
+	table  string
+	target []string
+	key    []string
+	track  bool
+}
+
+// Builder builds commands from parsed document.
+type Builder interface {
+	Build(jwalk.ObjectWalker) (Commands, error)
+}
+
+// Engine builds commands from parsed document
+// and executes them on a database.
+type Engine interface {
+	Builder
+	Execer
+}
 
-type command struct {
-	q    string
-	args []interface{}
+// Truncater is implemented by engines which are
+// able to remove existing records of tables
+// mentioned in the document before seeding.
+type Truncater interface {
+	BuildTruncate(jwalk.ObjectWalker) (Commands, error)
 }
 
-type builder interface {
-	build(jwalk.ObjectWalker) (commands, error)
+// Cleaner is implemented by engines which are
+// able to remove records they inserted. Commands
+// built by BuildTracked are executed with
+// ExecTracked, which returns commands removing
+// inserted records, records which existed before
+// are kept.
+type Cleaner interface {
+	BuildTracked(jwalk.ObjectWalker) (Commands, error)
+	ExecTracked(context.Context, []Command) (Commands, error)
 }
 
-type dbEngine interface {
-	builder
-	execer
+// Renderer is implemented by engines which are
+// able to write commands as a script runnable by
+// clients of the database.
+type Renderer interface {
+	Render(io.Writer, Commands) error
 }
 
 // Polluter pollutes database with given input.
 type Polluter struct {
-	dbEngine
-	parser
+	engine   Engine
+	parser   Parser
+	truncate bool
+	track    bool
+	template *templateOptions
+	fsys     fs.FS
+
+	factorySeed *int64
+
+	streamCommit int
+
+	mu      sync.Mutex
+	cleanup Commands
 }
 
 // Pollute parses input from the reader and
 // tries to exec generated commands on a database.
 // Use New factory function to generate.
 func (p *Polluter) Pollute(r io.Reader) error {
-	obj, err := p.parser.parse(r)
+	return p.PolluteContext(context.Background(), r)
+}
+
+// PolluteContext is like Pollute but stops reading
+// of the input and execution of commands when the
+// context is done. Changes made by engines which
+// implement ExecerContext are rolled back in that
+// case and errors.Cause of the returned error is
+// ctx.Err().
+func (p *Polluter) PolluteContext(ctx context.Context, r io.Reader) error {
+	obj, err := p.parse(ctx, r)
 	if err != nil {
-		return errors.Wrap(err, "parse failed")
+		return contextError(ctx, err)
+	}
+
+	return p.pollute(ctx, obj, obj, p.track)
+}
+
+// pollute builds and executes commands of the
+// document and remembers cleanup commands of
+// inserted records if track is set. Tables of
+// truncated document are truncated if truncate
+// is enabled and it isn't nil.
+func (p *Polluter) pollute(ctx context.Context, obj, truncated jwalk.ObjectWalker, track bool) error {
+	if !track {
+		commands, err := p.build(p.engine, obj, truncated)
+		if err != nil {
+			return err
+		}
+		if err := p.exec(ctx, commands); err != nil {
+			return contextError(ctx, errors.Wrap(err, "exec failed"))
+		}
+		return nil
 	}
 
-	commands, err := p.dbEngine.build(obj)
+	c, ok := p.engine.(Cleaner)
+	if !ok {
+		return errors.Wrap(ErrNotSupported, "cleanup")
+	}
+	commands, err := p.build(builderFunc(c.BuildTracked), obj, truncated)
 	if err != nil {
-		return errors.Wrap(err, "build commands failed")
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, errors.Wrap(err, "exec failed"))
 	}
-	if err := p.dbEngine.exec(commands); err != nil {
-		return errors.Wrap(err, "exec failed")
+	cleanup, err := c.ExecTracked(ctx, commands)
+	if err != nil {
+		return contextError(ctx, errors.Wrap(err, "exec failed"))
 	}
 
+	p.mu.Lock()
+	p.cleanup = append(cleanup, p.cleanup...)
+	p.mu.Unlock()
+
 	return nil
 }
 
+// builderFunc adapts the function to Builder.
+type builderFunc func(jwalk.ObjectWalker) (Commands, error)
+
+func (f builderFunc) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	return f(obj)
+}
+
+// Plan parses input from the reader and returns
+// commands Pollute would execute in the order
+// of execution, without executing them.
+func (p *Polluter) Plan(r io.Reader) (Commands, error) {
+	obj, err := p.parse(context.Background(), r)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.build(p.engine, obj, obj)
+}
+
+// parse parses the input, merges included
+// documents and expands factories of the
+// document.
+func (p *Polluter) parse(ctx context.Context, r io.Reader) (jwalk.ObjectWalker, error) {
+	obj, err := p.parseInput(ctx, r, p.parser)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err = p.include(ctx, p.fsys, obj, "", make(map[string]bool))
+	if err != nil {
+		return nil, errors.Wrap(err, "include failed")
+	}
+
+	return p.expand(obj)
+}
+
+// expand expands factories of the document.
+func (p *Polluter) expand(obj jwalk.ObjectWalker) (jwalk.ObjectWalker, error) {
+	var o templateOptions
+	if p.template != nil {
+		o = *p.template
+	}
+	if p.factorySeed != nil {
+		o.seed, o.seeded = *p.factorySeed, true
+	}
+	obj, err := expandFactories(obj, &o)
+	if err != nil {
+		return nil, errors.Wrap(err, "expand factories failed")
+	}
+	return obj, nil
+}
+
+// parseInput parses the input with the parser,
+// executing it as a template if it's enabled.
+func (p *Polluter) parseInput(ctx context.Context, r io.Reader, parser Parser) (jwalk.ObjectWalker, error) {
+	// CSV files are seeded to tables named by them.
+	if c, ok := parser.(csvParser); ok && c.options.table == "" {
+		if f, ok := r.(interface{ Name() string }); ok {
+			parser = c.forFile(filepath.ToSlash(f.Name()))
+		}
+	}
+
+	r = contextReader{ctx, r}
+	if p.template != nil {
+		var err error
+		if r, err = p.template.execute(r); err != nil {
+			return nil, errors.Wrap(err, "template failed")
+		}
+	}
+
+	obj, err := parser.Parse(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse failed")
+	}
+	return obj, nil
+}
+
+// build builds commands of the document with the
+// builder, commands removing existing records of
+// tables of truncated document go first if
+// truncate is enabled.
+func (p *Polluter) build(b Builder, obj, truncated jwalk.ObjectWalker) (Commands, error) {
+	commands, err := b.Build(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "build commands failed")
+	}
+
+	if p.truncate && truncated != nil {
+		t, ok := p.engine.(Truncater)
+		if !ok {
+			return nil, errors.Wrap(ErrNotSupported, "truncate")
+		}
+		truncate, err := t.BuildTruncate(truncated)
+		if err != nil {
+			return nil, errors.Wrap(err, "build truncate commands failed")
+		}
+		commands = append(truncate, commands...)
+	}
+
+	return commands, nil
+}
+
+// Render writes commands returned by Plan as
+// a script, if the engine implements Renderer.
+func (p *Polluter) Render(w io.Writer, commands Commands) error {
+	r, ok := p.engine.(Renderer)
+	if !ok {
+		return errors.Wrap(ErrNotSupported, "render")
+	}
+	return r.Render(w, commands)
+}
+
+// Cleanup removes records seeded by the Polluter
+// since the last cleanup, the latest are removed
+// first. It requires TrackCleanup option.
+func (p *Polluter) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+// CleanupContext is like Cleanup but stops
+// execution when the context is done.
+func (p *Polluter) CleanupContext(ctx context.Context) error {
+	if _, ok := p.engine.(Cleaner); !ok {
+		return errors.Wrap(ErrNotSupported, "cleanup")
+	}
+	if !p.track {
+		return errors.New("cleanup requires TrackCleanup option")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.cleanup) == 0 {
+		return nil
+	}
+	if err := p.exec(ctx, p.cleanup); err != nil {
+		return contextError(ctx, errors.Wrap(err, "exec failed"))
+	}
+	p.cleanup = nil
+
+	return nil
+}
+
+func (p *Polluter) exec(ctx context.Context, commands Commands) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if e, ok := p.engine.(ExecerContext); ok {
+		return e.ExecContext(ctx, commands)
+	}
+	return p.engine.Exec(commands)
+}
+
+// contextError replaces err with the context
+// error if the context is done, so the caller is
+// able to tell cancellation from other failures.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return errors.Wrap(ctxErr, "pollute canceled")
+	}
+	return err
+}
+
+// contextReader fails reading once
+// the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 // Option defines options for Polluter.
 type Option func(*Polluter)
 
-// MySQLEngine option enables MySQL
-// engine for poluter.
-func MySQLEngine(db *sql.DB) Option {
+// WithEngine option enables custom
+// engine for Polluter.
+func WithEngine(e Engine) Option {
 	return func(p *Polluter) {
-		p.dbEngine = mysqlEngine{db}
+		p.engine = e
 	}
 }
 
-// PostgresEngine option enables
-// Postgres engine for Polluter.
-func PostgresEngine(db *sql.DB) Option {
+// WithParser option enables custom
+// parsing engine for Polluter.
+func WithParser(parser Parser) Option {
 	return func(p *Polluter) {
-		p.dbEngine = postgresEngine{db}
+		p.parser = parser
 	}
 }
 
+// MySQLEngine option enables MySQL
+// engine for poluter.
+func MySQLEngine(db *sql.DB, options ...SQLOption) Option {
+	return WithEngine(mysqlEngine{db: db, options: newSQLOptions(options)})
+}
+
+// MySQLTxEngine option enables MySQL engine
+// which executes commands on the given
+// transaction or connection and never
+// commits them.
+func MySQLTxEngine(conn SQLConn, options ...SQLOption) Option {
+	return WithEngine(mysqlEngine{conn: conn, options: newSQLOptions(options)})
+}
+
+// PostgresEngine option enables
+// Postgres engine for Polluter.
+func PostgresEngine(db *sql.DB, options ...SQLOption) Option {
+	return WithEngine(postgresEngine{db: db, options: newSQLOptions(options)})
+}
+
+// PostgresTxEngine option enables Postgres
+// engine which executes commands on the given
+// transaction or connection and never
+// commits them.
+func PostgresTxEngine(conn SQLConn, options ...SQLOption) Option {
+	return WithEngine(postgresEngine{conn: conn, options: newSQLOptions(options)})
+}
+
+// SQLiteEngine option enables
+// SQLite engine for Polluter.
+func SQLiteEngine(db *sql.DB, options ...SQLOption) Option {
+	return WithEngine(sqliteEngine{db: db, options: newSQLOptions(options)})
+}
+
+// SQLiteTxEngine option enables SQLite
+// engine which executes commands on the given
+// transaction or connection and never
+// commits them.
+func SQLiteTxEngine(conn SQLConn, options ...SQLOption) Option {
+	return WithEngine(sqliteEngine{conn: conn, options: newSQLOptions(options)})
+}
+
 // RedisEngine option enables
 // Redis engine for Polluter.
-func RedisEngine(cli *redis.Client) Option {
-	return func(p *Polluter) {
-		p.dbEngine = redisEngine{cli}
+func RedisEngine(cli *redis.Client, options ...RedisOption) Option {
+	var o redisOptions
+	for i := range options {
+		options[i](&o)
 	}
+	return WithEngine(redisEngine{cli: cli, options: o})
+}
+
+// Truncate option makes Polluter remove existing
+// records of tables mentioned in the input before
+// seeding. Postgres engine truncates tables with
+// TRUNCATE ... RESTART IDENTITY CASCADE, MySQL and
+// SQLite engines delete records with foreign key
+// checks disabled and Redis engine deletes keys.
+func Truncate(p *Polluter) {
+	p.truncate = true
+}
+
+// TrackCleanup option makes Polluter remember keys
+// of records it inserts, so Cleanup removes them.
+// Records which existed before and were skipped or
+// updated on conflict are kept. SQL engines insert
+// records one by one when tracking is enabled and
+// remove records of tables without a primary key by
+// all their given values, Redis engine tracks keys
+// which didn't exist.
+func TrackCleanup(p *Polluter) {
+	p.track = true
 }
 
 // JSONParser option enambles JSON
@@ -104,18 +470,32 @@ func YAMLParser(p *Polluter) {
 	p.parser = yamlParser{}
 }
 
+// TOMLParser option enambles TOML
+// parsing engine for seeding.
+func TOMLParser(p *Polluter) {
+	p.parser = tomlParser{}
+}
+
 // New factory method returns initialized
 // Polluter.
 // For example to seed MySQL database with
 // JSON input use:
-//		p := New(MySQLEngine(db))
+//
+//	p := New(MySQLEngine(db))
+//
 // To seed Postgres database with YAML input
 // use:
-// 		p := New(PostgresEngine(db), YAMLParser)
+//
+//	p := New(PostgresEngine(db), YAMLParser)
+//
+// To seed database with custom engine
+// use:
+//
+//	p := New(WithEngine(e))
 func New(options ...Option) *Polluter {
 	p := Polluter{
-		parser:   yamlParser{},
-		dbEngine: errorEngine{},
+		parser: yamlParser{},
+		engine: errorEngine{},
 	}
 
 	for i := range options {
@@ -127,12 +507,12 @@ func New(options ...Option) *Polluter {
 
 type errorEngine struct{}
 
-func (e errorEngine) build(_ jwalk.ObjectWalker) (commands, error) {
-	return commands{
-		command{},
+func (e errorEngine) Build(_ jwalk.ObjectWalker) (Commands, error) {
+	return Commands{
+		Command{},
 	}, ErrEngineNotSpecified
 }
 
-func (e errorEngine) exec(_ []command) error {
+func (e errorEngine) Exec(_ []Command) error {
 	return ErrEngineNotSpecified
 }
@@ -1,11 +1,15 @@
 package polluter
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"strings"
 	"testing"
+	"time"
 
+	pkgerrors "github.com/pkg/errors"
 	"github.com/romanyx/jwalk"
 	"github.com/stretchr/testify/assert"
 )
@@ -31,27 +35,29 @@ func TestNew(t *testing.T) {
 
 type parserFunc func(io.Reader) (jwalk.ObjectWalker, error)
 
-func (f parserFunc) parse(r io.Reader) (jwalk.ObjectWalker, error) {
+func (f parserFunc) Parse(r io.Reader) (jwalk.ObjectWalker, error) {
 	return f(r)
 }
 
-type dbEngineFunc func([]command) error
+type engineFunc func([]Command) error
 
-func (f dbEngineFunc) exec(cmds []command) error {
+func (f engineFunc) Exec(cmds []Command) error {
 	return f(cmds)
 }
 
-func (f dbEngineFunc) build(obj jwalk.ObjectWalker) (commands, error) {
-	return commands{
-		command{
-			q: "INSERT INTO",
-			args: []interface{}{
+func (f engineFunc) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	return Commands{
+		Command{
+			Query: "INSERT INTO",
+			Args: []interface{}{
 				1,
 			},
 		},
 	}, nil
 }
 
+var errMocked = errors.New("mocked error")
+
 type objectWalker struct{}
 
 func (o objectWalker) Walk(fn func(name string, value interface{}) error) error {
@@ -62,12 +68,136 @@ func (o objectWalker) MarshalJSON() ([]byte, error) {
 	return make([]byte, 0), nil
 }
 
+func TestWithEngine(t *testing.T) {
+	var got []Command
+	p := New(
+		WithParser(parserFunc(func(r io.Reader) (jwalk.ObjectWalker, error) {
+			return new(objectWalker), nil
+		})),
+		WithEngine(engineFunc(func(cmds []Command) error {
+			got = cmds
+			return nil
+		})),
+	)
+
+	err := p.Pollute(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, []Command{
+		Command{
+			Query: "INSERT INTO",
+			Args: []interface{}{
+				1,
+			},
+		},
+	}, got)
+}
+
+type engineContextFunc func(context.Context, []Command) error
+
+func (f engineContextFunc) Exec(cmds []Command) error {
+	return f(context.Background(), cmds)
+}
+
+func (f engineContextFunc) ExecContext(ctx context.Context, cmds []Command) error {
+	return f(ctx, cmds)
+}
+
+func (f engineContextFunc) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	return Commands{}, nil
+}
+
+func TestPolluteContext(t *testing.T) {
+	jsonInput := `{"users":[{"id":1}]}`
+
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		engine Engine
+		expect error
+	}{
+		{
+			name: "canceled before parsing",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			engine: engineFunc(func(_ []Command) error {
+				return nil
+			}),
+			expect: context.Canceled,
+		},
+		{
+			name: "deadline exceeded on exec",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond)
+			},
+			engine: engineContextFunc(func(ctx context.Context, _ []Command) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+			expect: context.DeadlineExceeded,
+		},
+		{
+			name: "engine error",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			engine: engineContextFunc(func(_ context.Context, _ []Command) error {
+				return errMocked
+			}),
+			expect: errMocked,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			p := New(WithEngine(tt.engine), JSONParser)
+			err := p.PolluteContext(ctx, strings.NewReader(jsonInput))
+			assert.Equal(t, tt.expect, pkgerrors.Cause(err))
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	p := New(WithEngine(engineFunc(func(_ []Command) error {
+		return nil
+	})), Truncate)
+
+	err := p.Pollute(strings.NewReader(input))
+	assert.Equal(t, ErrNotSupported, pkgerrors.Cause(err))
+	assert.Equal(t, ErrNotSupported, pkgerrors.Cause(p.Cleanup()))
+}
+
+func TestPlan(t *testing.T) {
+	p := New(WithEngine(engineFunc(func(_ []Command) error {
+		t.Fatal("commands must not be executed")
+		return nil
+	})))
+
+	got, err := p.Plan(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, Commands{
+		Command{
+			Query: "INSERT INTO",
+			Args:  []interface{}{1},
+		},
+	}, got)
+	assert.Equal(t, ErrNotSupported, pkgerrors.Cause(p.Render(new(bytes.Buffer), got)))
+}
+
 func Test_polluterPollute(t *testing.T) {
 	tests := []struct {
-		name     string
-		parser   parser
-		dbEngine dbEngine
-		wantErr  bool
+		name    string
+		parser  Parser
+		engine  Engine
+		wantErr bool
 	}{
 		{
 			name: "parsing error",
@@ -81,7 +211,7 @@ func Test_polluterPollute(t *testing.T) {
 			parser: parserFunc(func(r io.Reader) (jwalk.ObjectWalker, error) {
 				return new(objectWalker), nil
 			}),
-			dbEngine: dbEngineFunc(func(_ []command) error {
+			engine: engineFunc(func(_ []Command) error {
 				return errors.New("mocked error")
 			}),
 			wantErr: true,
@@ -91,7 +221,7 @@ func Test_polluterPollute(t *testing.T) {
 			parser: parserFunc(func(r io.Reader) (jwalk.ObjectWalker, error) {
 				return new(objectWalker), nil
 			}),
-			dbEngine: dbEngineFunc(func(_ []command) error {
+			engine: engineFunc(func(_ []Command) error {
 				return nil
 			}),
 		},
@@ -103,8 +233,8 @@ func Test_polluterPollute(t *testing.T) {
 			t.Parallel()
 
 			p := &Polluter{
-				parser:   tt.parser,
-				dbEngine: tt.dbEngine,
+				parser: tt.parser,
+				engine: tt.engine,
 			}
 
 			err := p.Pollute(nil)
@@ -1,84 +1,297 @@
 package polluter
 
 import (
+	"context"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"strings"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/romanyx/jwalk"
 )
 
 type postgresEngine struct {
-	db *sql.DB
+	db      *sql.DB
+	conn    SQLConn
+	options sqlOptions
 }
 
-func (e postgresEngine) exec(cmds []command) error {
-	tx, err := e.db.Begin()
+func (e postgresEngine) Exec(cmds []Command) error {
+	return e.ExecContext(context.Background(), cmds)
+}
+
+func (e postgresEngine) ExecContext(ctx context.Context, cmds []Command) error {
+	return execSQL(ctx, e, e.db, e.conn, cmds)
+}
+
+func (e postgresEngine) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	return buildInserts(e, e.options, obj)
+}
+
+func (e postgresEngine) BuildTruncate(obj jwalk.ObjectWalker) (Commands, error) {
+	return buildTruncate(e, obj)
+}
+
+// BuildTracked builds inserts of records one by one
+// with their keys, so they're removed by cleanup.
+func (e postgresEngine) BuildTracked(obj jwalk.ObjectWalker) (Commands, error) {
+	o := e.options
+	o.track = true
+	return buildInserts(e, o, obj)
+}
+
+func (e postgresEngine) ExecTracked(ctx context.Context, cmds []Command) (Commands, error) {
+	return execTracked(ctx, e, e.db, e.conn, cmds)
+}
+
+func (e postgresEngine) Verify(ctx context.Context, obj jwalk.ObjectWalker) (Diff, error) {
+	return verifySQL(ctx, e, sqlHandle(e.db, e.conn), obj)
+}
+
+func (e postgresEngine) Export(ctx context.Context, sources []Source) (Document, error) {
+	return exportSQL(ctx, e, sqlHandle(e.db, e.conn), sources)
+}
+
+func (e postgresEngine) Render(w io.Writer, cmds Commands) error {
+	return renderSQL(w, e, cmds)
+}
+
+// literal formats binary values as bytea, strings
+// rely on standard_conforming_strings enabled.
+func (e postgresEngine) literal(arg interface{}) (string, error) {
+	if b, ok := arg.([]byte); ok {
+		return `'\x` + hex.EncodeToString(b) + "'::bytea", nil
+	}
+	return formatLiteral(arg, quoteString)
+}
+
+func (e postgresEngine) quote(name string) string {
+	return escape(name)
+}
+
+// PostgresCopy option makes Postgres engine load
+// records of the given tables, or of all tables if
+// none are given, with COPY FROM STDIN statement
+// in the same transaction. Labelled records and
+// records with references are still inserted with
+// INSERT statement. COPY can't be used with
+// PostgresTxEngine outside of a transaction.
+func PostgresCopy(tables ...string) SQLOption {
+	return func(o *sqlOptions) {
+		if len(tables) == 0 {
+			o.copy = true
+			return
+		}
+
+		if o.copyTables == nil {
+			o.copyTables = make(map[string]bool)
+		}
+		for _, t := range tables {
+			o.copyTables[t] = true
+		}
+	}
+}
+
+func (e postgresEngine) copy(table string) bool {
+	return e.options.copy || e.options.copyTables[table]
+}
+
+func (e postgresEngine) conflict(c conflictOption, columns []string, labelled bool) (string, string, error) {
+	clause, err := onConflictClause(e, c, columns, labelled)
+	return "INSERT", clause, err
+}
+
+func (e postgresEngine) truncate(tables []string) Commands {
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = e.quote(t)
+	}
+
+	return Commands{
+		Command{
+			Query: fmt.Sprintf("TRUNCATE %s RESTART IDENTITY CASCADE;", strings.Join(quoted, ", ")),
+		},
+	}
+}
+
+// syncSequences sets sequences owned by columns of
+// the tables, including identity columns, so the
+// next value follows the max value of the column.
+func (e postgresEngine) syncSequences(tables []string) Commands {
+	literals := make([]string, len(tables))
+	for i, t := range tables {
+		literals[i] = quoteString(e.quote(t))
+	}
+
+	return Commands{
+		Command{
+			Query: fmt.Sprintf(`DO $$
+DECLARE
+	t text;
+	r record;
+BEGIN
+	FOREACH t IN ARRAY ARRAY[%s] LOOP
+		FOR r IN
+			SELECT a.attname AS col, pg_get_serial_sequence(t, a.attname) AS seq
+			FROM pg_attribute a
+			WHERE a.attrelid = t::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		LOOP
+			IF r.seq IS NOT NULL THEN
+				EXECUTE format('SELECT setval(%%L, COALESCE(max(%%I), 0) + 1, false) FROM %%s', r.seq, r.col, t);
+			END IF;
+		END LOOP;
+	END LOOP;
+END $$;`, strings.Join(literals, ", ")),
+		},
+	}
+}
+
+func (e postgresEngine) primaryKey(table string) ([]string, error) {
+	return queryColumns(sqlHandle(e.db, e.conn), `
+SELECT kcu.column_name
+FROM information_schema.table_constraints tc
+JOIN information_schema.key_column_usage kcu
+	ON kcu.constraint_schema = tc.constraint_schema
+	AND kcu.constraint_name = tc.constraint_name
+WHERE tc.constraint_type = 'PRIMARY KEY'
+	AND tc.table_schema = current_schema()
+	AND tc.table_name = $1
+ORDER BY kcu.ordinal_position`, table)
+}
+
+func (e postgresEngine) foreignKeys() (map[string][]string, error) {
+	return queryForeignKeys(sqlHandle(e.db, e.conn), `
+SELECT DISTINCT tc.table_name, ccu.table_name
+FROM information_schema.table_constraints tc
+JOIN information_schema.constraint_column_usage ccu
+	ON ccu.constraint_schema = tc.constraint_schema
+	AND ccu.constraint_name = tc.constraint_name
+WHERE tc.constraint_type = 'FOREIGN KEY'
+	AND tc.table_schema = current_schema()
+ORDER BY 1, 2`)
+}
+
+func (e postgresEngine) constraints(c Constraints) (Commands, Commands) {
+	if c == ConstraintsDisabled {
+		return Commands{Command{Query: "SET session_replication_role = replica;"}},
+			Commands{Command{Query: "RESET session_replication_role;"}}
+	}
+	return Commands{Command{Query: "SET CONSTRAINTS ALL DEFERRED;"}},
+		Commands{Command{Query: "SET CONSTRAINTS ALL IMMEDIATE;"}}
+}
+
+// reset does nothing since settings changed
+// with SET are rolled back with the transaction.
+func (e postgresEngine) reset() Commands {
+	return nil
+}
+
+func (e postgresEngine) checkConstraints(ctx context.Context, conn SQLConn) error {
+	if !e.options.validate {
+		return nil
+	}
+
+	fks, err := queryForeignKeyColumns(ctx, conn, `
+SELECT con.conname, cl.relname, a.attname, fcl.relname, fa.attname
+FROM pg_constraint con
+JOIN pg_class cl ON cl.oid = con.conrelid
+JOIN pg_class fcl ON fcl.oid = con.confrelid
+JOIN pg_namespace n ON n.oid = cl.relnamespace
+CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(col, fcol, pos)
+JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.col
+JOIN pg_attribute fa ON fa.attrelid = con.confrelid AND fa.attnum = k.fcol
+WHERE con.contype = 'f'
+	AND n.nspname = current_schema()
+ORDER BY cl.relname, con.conname, k.pos`)
 	if err != nil {
-		return errors.Wrap(err, "tx begin")
+		return errors.Wrap(err, "foreign keys")
 	}
 
-	for _, c := range cmds {
-		if _, err := tx.Exec(c.q, c.args...); err != nil {
-			if rErr := tx.Rollback(); rErr != nil {
-				err = errors.Wrap(rErr, err.Error())
+	return checkOrphans(ctx, e, conn, fks)
+}
+
+// PostgresArrays option makes Postgres engine
+// store arrays of strings, numbers or booleans
+// as native arrays instead of JSON.
+func PostgresArrays(o *sqlOptions) {
+	o.arrays = true
+}
+
+func (e postgresEngine) arg(value interface{}) (interface{}, error) {
+	if v, ok := value.(jwalk.Value); ok && e.options.arrays {
+		if items, ok := v.Interface().([]interface{}); ok {
+			if arr, ok := pgArray(items); ok {
+				return arr, nil
+			}
+			if e.options.strict {
+				return nil, errors.New("array can't be stored as native array")
 			}
-			return errors.Wrap(err, "exec")
 		}
 	}
 
-	return errors.Wrap(tx.Commit(), "commit")
+	return jsonArg(value, e.options)
 }
 
-func escape(name string) string {
-	return fmt.Sprintf(`"%s"`, name)
-}
-
-func (e postgresEngine) build(obj jwalk.ObjectWalker) (commands, error) {
-	cmds := make(commands, 0)
-
-	if err := obj.Walk(func(table string, value interface{}) error {
-		if v, ok := value.(jwalk.ObjectsWalker); ok {
-			if err := v.Walk(func(obj jwalk.ObjectWalker) error {
-				values := make([]interface{}, 0)
-				insert := fmt.Sprintf("INSERT INTO %s (", escape(table))
-				valuesStr := "("
-
-				first := true
-				var i int
-				if err := obj.Walk(func(field string, value interface{}) error {
-					if v, ok := value.(jwalk.Value); ok {
-						values = append(values, v.Interface())
-
-						if !first {
-							insert = insert + ", "
-							valuesStr = valuesStr + ", "
-						}
-
-						insert = insert + escape(field)
-						valuesStr = valuesStr + fmt.Sprintf("$%d", i+1)
-					}
-
-					if first {
-						first = false
-					}
-					i++
-					return nil
-				}); err != nil {
-					return err
-				}
-
-				insert = insert + ") VALUES " + valuesStr + ");"
-				cmds = append(cmds, command{insert, values})
-				return nil
-			}); err != nil {
-				return err
-			}
+// pgArray converts array of values with the same
+// scalar type to the native array argument.
+func pgArray(items []interface{}) (interface{}, bool) {
+	if len(items) == 0 {
+		return pq.Array([]string{}), true
+	}
+
+	var (
+		ints   []int64
+		floats []float64
+		strs   []string
+		bools  []bool
+	)
+
+	for _, item := range items {
+		switch v := item.(type) {
+		case int64:
+			ints = append(ints, v)
+			floats = append(floats, float64(v))
+		case float64:
+			floats = append(floats, v)
+		case string:
+			strs = append(strs, v)
+		case bool:
+			bools = append(bools, v)
+		default:
+			return nil, false
 		}
-		return nil
-	}); err != nil {
-		return nil, err
 	}
 
-	return cmds, nil
+	switch len(items) {
+	case len(ints):
+		return pq.Array(ints), true
+	case len(floats):
+		return pq.Array(floats), true
+	case len(strs):
+		return pq.Array(strs), true
+	case len(bools):
+		return pq.Array(bools), true
+	}
+
+	return nil, false
+}
+
+func (e postgresEngine) returning() bool {
+	return true
+}
+
+// limits of placeholders in the extended protocol.
+func (e postgresEngine) limits() (int, int) {
+	return 65535, 0
+}
+
+func (e postgresEngine) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func escape(name string) string {
+	return fmt.Sprintf(`"%s"`, strings.Replace(name, `"`, `""`, -1))
 }
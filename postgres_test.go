@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,34 +16,53 @@ func Test_postgresEngine_build(t *testing.T) {
 	tests := []struct {
 		name   string
 		input  []byte
-		expect commands
+		expect Commands
 	}{
 		{
 			name:  "example input",
-			input: []byte(`{"users":[{"id":1,"name":"Roman"},{"id":2,"name":"Dmitry"}],"roles":[{"id":2,"role_ids":[1,2]}]}`),
-			expect: commands{
-				command{
-					q: `INSERT INTO "users" ("id", "name") VALUES ($1, $2);`,
-					args: []interface{}{
+			input: []byte(`{"users":[{"id":1,"name":"Roman"},{"id":2,"name":"Dmitry"}],"roles":[{"id":2,"role_ids":[1,2],"meta":{"key":"value"}}]}`),
+			expect: Commands{
+				Command{
+					Query: `INSERT INTO "users" ("id", "name") VALUES ($1, $2);`,
+					Args: []interface{}{
 						float64(1),
 						"Roman",
 					},
 				},
-				command{
-					q: `INSERT INTO "users" ("id", "name") VALUES ($1, $2);`,
-					args: []interface{}{
+				Command{
+					Query: `INSERT INTO "users" ("id", "name") VALUES ($1, $2);`,
+					Args: []interface{}{
 						float64(2),
 						"Dmitry",
 					},
 				},
-				command{
-					q: `INSERT INTO "roles" ("id", "role_ids") VALUES ($1, $2);`,
-					args: []interface{}{
+				Command{
+					Query: `INSERT INTO "roles" ("id", "role_ids", "meta") VALUES ($1, $2, $3);`,
+					Args: []interface{}{
 						float64(2),
-						[]interface{}{
-							float64(1),
-							float64(2),
-						},
+						"[1,2]",
+						`{"key":"value"}`,
+					},
+				},
+			},
+		},
+		{
+			name:  "labelled records",
+			input: []byte(`{"roles":[{"_ref":"admin","name":"Admin"}],"users":[{"name":"Roman","role_id":{"$ref":"admin.id"}}]}`),
+			expect: Commands{
+				Command{
+					Query: `INSERT INTO "roles" ("name") VALUES ($1) RETURNING *;`,
+					Args: []interface{}{
+						"Admin",
+					},
+					Label:   "admin",
+					Columns: []string{"name"},
+				},
+				Command{
+					Query: `INSERT INTO "users" ("name", "role_id") VALUES ($1, $2);`,
+					Args: []interface{}{
+						"Roman",
+						Ref{Label: "admin", Column: "id"},
 					},
 				},
 			},
@@ -54,13 +74,93 @@ func Test_postgresEngine_build(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			obj, err := jsonParser{}.parse(bytes.NewReader(tt.input))
+			obj, err := jsonParser{}.Parse(bytes.NewReader(tt.input))
 			if err != nil {
 				assert.Nil(t, err)
 			}
 
-			e := postgresEngine{}
-			got, err := e.build(obj)
+			e := postgresEngine{options: newSQLOptions([]SQLOption{KeepSequences})}
+			got, err := e.Build(obj)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_postgresEngine_syncSequences(t *testing.T) {
+	cmds := postgresEngine{}.syncSequences([]string{"users", "user's"})
+	assert.Len(t, cmds, 1)
+	assert.Contains(t, cmds[0].Query, `FOREACH t IN ARRAY ARRAY['"users"', '"user''s"'] LOOP`)
+	assert.Contains(t, cmds[0].Query, `setval(%L, COALESCE(max(%I), 0) + 1, false)`)
+	assert.Empty(t, cmds[0].Args)
+}
+
+func Test_postgresEngine_arg(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []SQLOption
+		input   []byte
+		expect  interface{}
+		wantErr bool
+	}{
+		{
+			name:   "json array",
+			input:  []byte(`{"v":[1, 2]}`),
+			expect: "[1,2]",
+		},
+		{
+			name:    "native array",
+			options: []SQLOption{PostgresArrays},
+			input:   []byte(`{"v":["a","b"]}`),
+			expect:  pq.Array([]string{"a", "b"}),
+		},
+		{
+			name:    "empty native array",
+			options: []SQLOption{PostgresArrays},
+			input:   []byte(`{"v":[]}`),
+			expect:  pq.Array([]string{}),
+		},
+		{
+			name:    "mixed array",
+			options: []SQLOption{PostgresArrays},
+			input:   []byte(`{"v":[1,"a"]}`),
+			expect:  `[1,"a"]`,
+		},
+		{
+			name:    "strict mixed array",
+			options: []SQLOption{PostgresArrays, Strict},
+			input:   []byte(`{"v":[1,"a"]}`),
+			wantErr: true,
+		},
+		{
+			name:   "array of objects",
+			input:  []byte(`{"v":[{"key":"value"}]}`),
+			expect: `[{"key":"value"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(bytes.NewReader(tt.input))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			e := postgresEngine{options: newSQLOptions(tt.options)}
+			var got interface{}
+			obj.Walk(func(_ string, value interface{}) error {
+				got, err = e.arg(value)
+				return nil
+			})
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
 			assert.Nil(t, err)
 			assert.Equal(t, tt.expect, got)
 		})
@@ -74,27 +174,37 @@ func Test_postgresEngine_exec(t *testing.T) {
 
 	tests := []struct {
 		name    string
-		args    []command
+		args    []Command
 		wantErr bool
 	}{
 		{
 			name: "valid query",
-			args: []command{
-				command{
-					q: `INSERT INTO "users" ("id", "name") VALUES ($1, $2);`,
-					args: []interface{}{
+			args: []Command{
+				Command{
+					Query: `INSERT INTO "users" ("id", "name") VALUES ($1, $2);`,
+					Args: []interface{}{
 						1,
 						"Roman",
 					},
 				},
 			},
 		},
+		{
+			name: "copy",
+			args: []Command{
+				Command{
+					Query:   `COPY "users" ("id", "name") FROM STDIN`,
+					Args:    []interface{}{1, "Roman", 2, "Dmitry"},
+					Columns: []string{"id", "name"},
+				},
+			},
+		},
 		{
 			name: "invalid query",
-			args: []command{
-				command{
-					q: `INSERT INTO "roles" ("id", "name") VALUES ($1, $2);`,
-					args: []interface{}{
+			args: []Command{
+				Command{
+					Query: `INSERT INTO "roles" ("id", "name") VALUES ($1, $2);`,
+					Args: []interface{}{
 						1,
 						"User",
 					},
@@ -111,9 +221,9 @@ func Test_postgresEngine_exec(t *testing.T) {
 
 			db, teardown := preparePostgresDB(t)
 			defer teardown()
-			e := postgresEngine{db}
+			e := postgresEngine{db: db}
 
-			err := e.exec(tt.args)
+			err := e.Exec(tt.args)
 
 			if tt.wantErr && err == nil {
 				assert.NotNil(t, err)
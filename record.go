@@ -0,0 +1,140 @@
+package polluter
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+const (
+	// labelField names the record, so other
+	// records are able to refer to it.
+	labelField = "_ref"
+	// refKey is the only key of the object
+	// which refers to the labelled record.
+	refKey = "$ref"
+)
+
+// directives are top level keys of the document
+// which configure seeding instead of holding records.
+var directives = map[string]bool{
+	conflictField: true,
+	includeField:  true,
+}
+
+// Record is a single record of a table
+// from the parsed document.
+type Record struct {
+	Table string
+	// Label is given with the _ref field
+	// of the record.
+	Label  string
+	Fields []Field
+}
+
+// Field is a single field of the record.
+// Value is one of jwalk.Value, jwalk.ObjectWalker,
+// jwalk.ObjectsWalker or Ref.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Ref refers to the column of the labelled record.
+// It's given as {"$ref": "label.column"} object in
+// JSON or with !ref label.column tag in YAML and
+// is resolved when commands are executed, so it's
+// able to refer to generated values like primary keys.
+type Ref struct {
+	Label  string
+	Column string
+}
+
+// String returns the reference in label.column form.
+func (r Ref) String() string {
+	return r.Label + "." + r.Column
+}
+
+// WalkRecords iterates through records of the document
+// in the order they were given. Every top level key of
+// the document is treated as a table and every object
+// of its array as a record, other keys are skipped.
+func WalkRecords(obj jwalk.ObjectWalker, fn func(Record) error) error {
+	return obj.Walk(func(table string, value interface{}) error {
+		objs, ok := value.(jwalk.ObjectsWalker)
+		if !ok {
+			return nil
+		}
+
+		return objs.Walk(func(obj jwalk.ObjectWalker) error {
+			rec := Record{
+				Table:  table,
+				Fields: make([]Field, 0),
+			}
+
+			if err := obj.Walk(func(name string, value interface{}) error {
+				if name == labelField {
+					v, ok := value.(jwalk.Value)
+					if !ok {
+						return errors.Errorf("%s: %s must be a string", table, labelField)
+					}
+					rec.Label = v.String()
+					return nil
+				}
+
+				ref, ok, err := parseRef(value)
+				if err != nil {
+					return errors.Wrapf(err, "%s.%s", table, name)
+				}
+				if ok {
+					value = ref
+				}
+
+				rec.Fields = append(rec.Fields, Field{name, value})
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			return fn(rec)
+		})
+	})
+}
+
+// parseRef returns the reference if the
+// value is an object with only $ref key.
+func parseRef(value interface{}) (Ref, bool, error) {
+	obj, ok := value.(jwalk.ObjectWalker)
+	if !ok {
+		return Ref{}, false, nil
+	}
+
+	var (
+		s     string
+		isRef bool
+	)
+	if err := obj.Walk(func(name string, value interface{}) error {
+		v, ok := value.(jwalk.Value)
+		if name != refKey || !ok || isRef {
+			isRef = false
+			return errNotRef
+		}
+		s, isRef = v.String(), true
+		return nil
+	}); err != nil && err != errNotRef {
+		return Ref{}, false, err
+	}
+	if !isRef {
+		return Ref{}, false, nil
+	}
+
+	i := strings.LastIndex(s, ".")
+	if i <= 0 || i == len(s)-1 {
+		return Ref{}, false, errors.Errorf("invalid reference %q, expected label.column", s)
+	}
+
+	return Ref{Label: s[:i], Column: s[i+1:]}, true, nil
+}
+
+var errNotRef = errors.New("not a reference")
@@ -0,0 +1,92 @@
+package polluter
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/romanyx/jwalk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalkRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		expect  []string
+		wantErr bool
+	}{
+		{
+			name:  "example input",
+			input: []byte(`{"users":[{"id":1,"name":"Roman"},{"id":2}],"count":1,"roles":[{"id":2,"meta":{"key":"value"}}]}`),
+			expect: []string{
+				"users.id=1",
+				"users.name=Roman",
+				"users.id=2",
+				"roles.id=2",
+				"roles.meta={\"key\":\"value\"}",
+			},
+		},
+		{
+			name:  "references",
+			input: []byte(`{"roles":[{"_ref":"admin","name":"Admin"}],"users":[{"role_id":{"$ref":"admin.id"},"meta":{"$ref":"admin.id","key":"value"}}]}`),
+			expect: []string{
+				"roles#admin.name=Admin",
+				"users.role_id=ref:admin.id",
+				"users.meta={\"$ref\":\"admin.id\",\"key\":\"value\"}",
+			},
+		},
+		{
+			name:    "invalid reference",
+			input:   []byte(`{"users":[{"role_id":{"$ref":"admin"}}]}`),
+			wantErr: true,
+		},
+		{
+			name:    "invalid label",
+			input:   []byte(`{"users":[{"_ref":{"key":"value"}}]}`),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(bytes.NewReader(tt.input))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			var got []string
+			err = WalkRecords(obj, func(rec Record) error {
+				for _, f := range rec.Fields {
+					var value string
+					switch v := f.Value.(type) {
+					case jwalk.Value:
+						value = fmt.Sprint(v.Interface())
+					case jwalk.ObjectWalker:
+						data, _ := v.MarshalJSON()
+						value = string(data)
+					case Ref:
+						value = "ref:" + v.String()
+					}
+					table := rec.Table
+					if rec.Label != "" {
+						table = table + "#" + rec.Label
+					}
+					got = append(got, table+"."+f.Name+"="+value)
+				}
+				return nil
+			})
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
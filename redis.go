@@ -1,36 +1,138 @@
 package polluter
 
 import (
+	"context"
 	"encoding/json"
+	"sort"
+	"strings"
 
 	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
 	"github.com/romanyx/jwalk"
 )
 
+// RedisOption defines options for Redis engine.
+type RedisOption func(*redisOptions)
+
+type redisOptions struct {
+	flush  bool
+	prefix string
+}
+
+// RedisFlushDB option makes Redis engine
+// truncate the whole database with FLUSHDB.
+func RedisFlushDB(o *redisOptions) {
+	o.flush = true
+}
+
+// RedisKeyPrefix option makes Redis engine
+// truncate all keys with the prefix instead
+// of keys mentioned in the input.
+func RedisKeyPrefix(prefix string) RedisOption {
+	return func(o *redisOptions) {
+		o.prefix = prefix
+	}
+}
+
+// redisEngine sets keys with commands where Query
+// is a key and Args holds its value. Commands
+// without Args delete keys matching the pattern
+// in Query, exact keys are escaped.
 type redisEngine struct {
-	cli *redis.Client
+	cli     *redis.Client
+	options redisOptions
+}
+
+func (e redisEngine) Exec(cmds []Command) error {
+	return e.ExecContext(context.Background(), cmds)
 }
 
-func (e redisEngine) exec(cmds []command) error {
+// ExecContext sets keys in a single MULTI/EXEC
+// transaction, so nothing is set if the context
+// is done before the transaction is sent.
+func (e redisEngine) ExecContext(ctx context.Context, cmds []Command) error {
+	cli := e.cli.WithContext(ctx)
+	pipe := cli.TxPipeline()
+	defer pipe.Close()
+
 	for _, cmd := range cmds {
-		if err := e.cli.Set(cmd.q, cmd.args[0], 0).Err(); err != nil {
-			return errors.Wrap(err, "failed to set")
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+
+		if len(cmd.Args) > 0 {
+			pipe.Set(cmd.Query, cmd.Args[0], 0)
+			continue
+		}
+
+		key, isPattern := unescapeGlob(cmd.Query)
+		switch {
+		case cmd.Query == "*":
+			pipe.FlushDB()
+		case !isPattern:
+			pipe.Del(key)
+		default:
+			keys, err := scanKeys(cli, cmd.Query)
+			if err != nil {
+				return errors.Wrap(err, "failed to scan")
+			}
+			if len(keys) > 0 {
+				pipe.Del(keys...)
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "failed to set")
 	}
 	return nil
 }
 
-func (e redisEngine) build(obj jwalk.ObjectWalker) (commands, error) {
-	cmds := make(commands, 0)
+func (e redisEngine) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	cmds := make(Commands, 0)
 
 	if err := obj.Walk(func(key string, value interface{}) error {
+		if directives[key] {
+			return nil
+		}
+
 		data, err := json.Marshal(value)
 		if err != nil {
 			return err
 		}
 
-		cmds = append(cmds, command{key, []interface{}{data}})
+		cmds = append(cmds, Command{Query: key, Args: []interface{}{data}})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return cmds, nil
+}
+
+func (e redisEngine) BuildTruncate(obj jwalk.ObjectWalker) (Commands, error) {
+	switch {
+	case e.options.flush:
+		return Commands{Command{Query: "*"}}, nil
+	case e.options.prefix != "":
+		return Commands{Command{Query: escapeGlob(e.options.prefix) + "*"}}, nil
+	}
+
+	return e.buildDelete(obj)
+}
+
+// buildDelete builds commands deleting
+// keys mentioned in the document.
+func (e redisEngine) buildDelete(obj jwalk.ObjectWalker) (Commands, error) {
+	cmds := make(Commands, 0)
+
+	if err := obj.Walk(func(key string, _ interface{}) error {
+		if !directives[key] {
+			cmds = append(cmds, Command{Query: escapeGlob(key)})
+		}
 		return nil
 	}); err != nil {
 		return nil, err
@@ -38,3 +140,197 @@ func (e redisEngine) build(obj jwalk.ObjectWalker) (commands, error) {
 
 	return cmds, nil
 }
+
+func (e redisEngine) BuildTracked(obj jwalk.ObjectWalker) (Commands, error) {
+	return e.Build(obj)
+}
+
+// ExecTracked executes commands and returns commands
+// deleting keys which didn't exist before. Keys
+// deleted by truncate commands are treated as
+// missing.
+func (e redisEngine) ExecTracked(ctx context.Context, cmds []Command) (Commands, error) {
+	cli := e.cli.WithContext(ctx)
+
+	var flushed bool
+	deleted := make(map[string]bool)
+	tracked := make(map[string]bool)
+	cleanup := make(Commands, 0)
+	for _, cmd := range cmds {
+		if len(cmd.Args) == 0 {
+			key, isPattern := unescapeGlob(cmd.Query)
+			switch {
+			case cmd.Query == "*":
+				flushed = true
+			case !isPattern:
+				deleted[key] = true
+			default:
+				keys, err := scanKeys(cli, cmd.Query)
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to scan")
+				}
+				for _, key := range keys {
+					deleted[key] = true
+				}
+			}
+			continue
+		}
+
+		if tracked[cmd.Query] {
+			continue
+		}
+		if !flushed && !deleted[cmd.Query] {
+			n, err := cli.Exists(cmd.Query).Result()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check %s", cmd.Query)
+			}
+			if n > 0 {
+				continue
+			}
+		}
+		tracked[cmd.Query] = true
+		cleanup = append(Commands{Command{Query: escapeGlob(cmd.Query)}}, cleanup...)
+	}
+
+	if err := e.ExecContext(ctx, cmds); err != nil {
+		return nil, err
+	}
+	return cleanup, nil
+}
+
+// Verify compares JSON values of keys
+// regardless of formatting.
+func (e redisEngine) Verify(ctx context.Context, obj jwalk.ObjectWalker) (Diff, error) {
+	cli := e.cli.WithContext(ctx)
+
+	var diff Diff
+	if err := obj.Walk(func(key string, value interface{}) error {
+		if directives[key] {
+			return nil
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		expected, err := decodeJSON(data)
+		if err != nil {
+			return errors.Wrap(err, key)
+		}
+
+		actual, err := cli.Get(key).Bytes()
+		if err == redis.Nil {
+			diff.Missing = append(diff.Missing, Row{Table: key})
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get %s", key)
+		}
+
+		if !equalJSON(string(data), string(actual)) && string(data) != string(actual) {
+			v, err := decodeJSON(actual)
+			if err != nil {
+				v = string(actual)
+			}
+			diff.Mismatched = append(diff.Mismatched, Mismatch{
+				Table:  key,
+				Fields: []FieldDiff{{Name: key, Expected: expected, Actual: v}},
+			})
+		}
+		return nil
+	}); err != nil {
+		return Diff{}, err
+	}
+
+	return diff, nil
+}
+
+// Export reads keys matching the patterns in
+// lexical order, values which aren't JSON are
+// exported as strings.
+func (e redisEngine) Export(ctx context.Context, sources []Source) (Document, error) {
+	cli := e.cli.WithContext(ctx)
+
+	doc := make(Document, 0)
+	seen := make(map[string]bool)
+	for _, s := range sources {
+		if s.Where != "" {
+			return nil, errors.Errorf("%s: conditions aren't supported", s.Name)
+		}
+
+		keys, err := scanKeys(cli, s.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan")
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			data, err := cli.Get(key).Bytes()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get %s", key)
+			}
+
+			v, err := decodeJSON(data)
+			if err != nil {
+				v = string(data)
+			}
+			doc = append(doc, KeyValue{key, v})
+		}
+	}
+
+	return doc, nil
+}
+
+func scanKeys(cli *redis.Client, pattern string) ([]string, error) {
+	keys := make([]string, 0)
+	iter := cli.Scan(0, pattern, 100).Iterator()
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// escapeGlob escapes special characters
+// of Redis glob-style patterns.
+func escapeGlob(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// unescapeGlob returns the key of the pattern and
+// whether the pattern has unescaped special characters.
+func unescapeGlob(pattern string) (string, bool) {
+	var (
+		b       strings.Builder
+		escaped bool
+		glob    bool
+	)
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '*' || r == '?' || r == '[':
+			glob = true
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), glob
+}
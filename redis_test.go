@@ -2,6 +2,7 @@ package polluter
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"testing"
 
@@ -14,27 +15,27 @@ func Test_redisEngine_build(t *testing.T) {
 	tests := []struct {
 		name   string
 		input  []byte
-		expect commands
+		expect Commands
 	}{
 		{
 			name:  "example input",
 			input: []byte(`{"count":1,"values":[1,2],"obj":{"key":"value"}}`),
-			expect: commands{
-				command{
-					q: "count",
-					args: []interface{}{
+			expect: Commands{
+				Command{
+					Query: "count",
+					Args: []interface{}{
 						[]byte(`1`),
 					},
 				},
-				command{
-					q: "values",
-					args: []interface{}{
+				Command{
+					Query: "values",
+					Args: []interface{}{
 						[]byte(`[1,2]`),
 					},
 				},
-				command{
-					q: "obj",
-					args: []interface{}{
+				Command{
+					Query: "obj",
+					Args: []interface{}{
 						[]byte(`{"key":"value"}`),
 					},
 				},
@@ -47,19 +48,89 @@ func Test_redisEngine_build(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			obj, err := jsonParser{}.parse(bytes.NewReader(tt.input))
+			obj, err := jsonParser{}.Parse(bytes.NewReader(tt.input))
 			if err != nil {
 				assert.Nil(t, err)
 			}
 
 			e := redisEngine{}
-			got, err := e.build(obj)
+			got, err := e.Build(obj)
 			assert.Nil(t, err)
 			assert.Equal(t, tt.expect, got)
 		})
 	}
 }
 
+func Test_redisEngine_buildTruncate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []RedisOption
+		expect  Commands
+	}{
+		{
+			name: "keys",
+			expect: Commands{
+				Command{Query: "count"},
+				Command{Query: `key\*`},
+			},
+		},
+		{
+			name:    "flush db",
+			options: []RedisOption{RedisFlushDB},
+			expect: Commands{
+				Command{Query: "*"},
+			},
+		},
+		{
+			name:    "prefix",
+			options: []RedisOption{RedisKeyPrefix("test:")},
+			expect: Commands{
+				Command{Query: "test:*"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(bytes.NewReader([]byte(`{"count":1,"key*":2,"_conflict":{}}`)))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			var o redisOptions
+			for _, option := range tt.options {
+				option(&o)
+			}
+
+			e := redisEngine{options: o}
+			got, err := e.BuildTruncate(obj)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_unescapeGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		glob    bool
+	}{
+		{pattern: "users", key: "users"},
+		{pattern: escapeGlob("users:[1]*"), key: "users:[1]*"},
+		{pattern: "users:*", key: "users:*", glob: true},
+	}
+
+	for _, tt := range tests {
+		key, glob := unescapeGlob(tt.pattern)
+		assert.Equal(t, tt.key, key)
+		assert.Equal(t, tt.glob, glob)
+	}
+}
+
 func Test_redisEngine_exec(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode")
@@ -67,15 +138,15 @@ func Test_redisEngine_exec(t *testing.T) {
 
 	tests := []struct {
 		name    string
-		args    []command
+		args    []Command
 		wantErr bool
 	}{
 		{
 			name: "valid query",
-			args: []command{
+			args: []Command{
 				{
-					q: "count",
-					args: []interface{}{
+					Query: "count",
+					Args: []interface{}{
 						"1",
 					},
 				},
@@ -91,9 +162,9 @@ func Test_redisEngine_exec(t *testing.T) {
 
 			cli, teardown := prepareRedisDB(t, i)
 			defer teardown()
-			e := redisEngine{cli}
+			e := redisEngine{cli: cli}
 
-			err := e.exec(tt.args)
+			err := e.Exec(tt.args)
 
 			if tt.wantErr && err == nil {
 				assert.NotNil(t, err)
@@ -107,6 +178,27 @@ func Test_redisEngine_exec(t *testing.T) {
 	}
 }
 
+func Test_redisEngine_execTracked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	cli, teardown := prepareRedisDB(t, 5)
+	defer teardown()
+	if err := cli.Set("roles", "[]", 0).Err(); err != nil {
+		t.Fatalf("set roles: %s", err)
+	}
+
+	e := redisEngine{cli: cli}
+	cleanup, err := e.ExecTracked(context.Background(), Commands{
+		{Query: "roles", Args: []interface{}{"[1]"}},
+		{Query: "users", Args: []interface{}{"[1]"}},
+		{Query: "users", Args: []interface{}{"[2]"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, Commands{{Query: "users"}}, cleanup)
+}
+
 func prepareRedisDB(t *testing.T, db int) (cli *redis.Client, teardown func() error) {
 	cli = redis.NewClient(&redis.Options{
 		Addr:     redisAddr,
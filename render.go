@@ -0,0 +1,254 @@
+package polluter
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// renderedRecord holds literals of the labelled
+// record, so references to it are rendered.
+type renderedRecord struct {
+	table   string
+	columns []string
+	values  []string
+}
+
+// renderSQL writes commands as a script executed in
+// a single transaction with arguments inlined as
+// literals. References to values given in the labelled
+// record are replaced with the values, others with
+// subqueries selecting the record by given values.
+// COPY commands are written as INSERT statements.
+func renderSQL(w io.Writer, d dialect, cmds Commands) error {
+	records := make(map[string]renderedRecord)
+
+	var b strings.Builder
+	b.WriteString("BEGIN;\n")
+	for i, c := range cmds {
+		args := make([]string, len(c.Args))
+		for j, arg := range c.Args {
+			s, err := renderArg(d, records, arg)
+			if err != nil {
+				return errors.Wrapf(err, "command %d", i)
+			}
+			args[j] = s
+		}
+
+		q := c.Query
+		switch {
+		case isCopy(c):
+			q = copyInsert(q, len(c.Columns), args)
+		case len(args) > 0:
+			var err error
+			if q, err = bindArgs(q, args); err != nil {
+				return errors.Wrapf(err, "command %d", i)
+			}
+		}
+
+		if c.Label != "" {
+			records[c.Label] = renderedRecord{
+				table:   insertTable(c.Query),
+				columns: c.Columns,
+				values:  args,
+			}
+		}
+
+		b.WriteString(q)
+		if !strings.HasSuffix(q, ";") {
+			b.WriteString(";")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("COMMIT;\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// renderArg formats the argument as a literal
+// or the reference as a value or a subquery.
+func renderArg(d dialect, records map[string]renderedRecord, arg interface{}) (string, error) {
+	ref, ok := arg.(Ref)
+	if !ok {
+		return d.literal(arg)
+	}
+
+	rec, ok := records[ref.Label]
+	if !ok {
+		return "", errors.Errorf("unknown record %s", ref.Label)
+	}
+
+	conditions := make([]string, 0, len(rec.columns))
+	for i, column := range rec.columns {
+		if column == ref.Column {
+			return rec.values[i], nil
+		}
+
+		if rec.values[i] == "NULL" {
+			conditions = append(conditions, fmt.Sprintf("%s IS NULL", d.quote(column)))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = %s", d.quote(column), rec.values[i]))
+	}
+	if len(conditions) == 0 || rec.table == "" {
+		return "", errors.Errorf("reference %s can't be rendered", ref)
+	}
+
+	return fmt.Sprintf(
+		"(SELECT %s FROM %s WHERE %s)",
+		d.quote(ref.Column),
+		rec.table,
+		strings.Join(conditions, " AND "),
+	), nil
+}
+
+// bindArgs replaces ? and $n placeholders outside
+// of quoted names and strings with the arguments.
+func bindArgs(q string, args []string) (string, error) {
+	var (
+		b    strings.Builder
+		next int
+	)
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := strings.IndexByte(q[i+1:], c)
+			if j < 0 {
+				j = len(q) - 1
+			} else {
+				j += i + 1
+			}
+			b.WriteString(q[i : j+1])
+			i = j
+		case c == '?':
+			if next >= len(args) {
+				return "", errors.New("not enough arguments")
+			}
+			b.WriteString(args[next])
+			next++
+		case c == '$' && i+1 < len(q) && isDigit(q[i+1]):
+			j := i + 1
+			for j < len(q) && isDigit(q[j]) {
+				j++
+			}
+			n, err := strconv.Atoi(q[i+1 : j])
+			if err != nil || n < 1 || n > len(args) {
+				return "", errors.Errorf("invalid placeholder %s", q[i:j])
+			}
+			b.WriteString(args[n-1])
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// copyInsert converts COPY statement with
+// rows of n values to INSERT statement.
+func copyInsert(q string, n int, args []string) string {
+	target := strings.TrimSuffix(strings.TrimPrefix(q, "COPY "), " FROM STDIN")
+
+	rows := make([]string, 0)
+	for i := 0; i+n <= len(args) && n > 0; i += n {
+		rows = append(rows, "("+strings.Join(args[i:i+n], ", ")+")")
+	}
+
+	return fmt.Sprintf("INSERT INTO %s VALUES %s;", target, strings.Join(rows, ", "))
+}
+
+// insertTable returns quoted name of the
+// table of INSERT statement.
+func insertTable(q string) string {
+	i := strings.Index(q, " INTO ")
+	if i < 0 {
+		return ""
+	}
+
+	name := q[i+len(" INTO "):]
+	if name == "" {
+		return ""
+	}
+	quote := name[0]
+	for j := 1; j < len(name); j++ {
+		if name[j] != quote {
+			continue
+		}
+		if j+1 < len(name) && name[j+1] == quote {
+			j++
+			continue
+		}
+		return name[:j+1]
+	}
+
+	return ""
+}
+
+// formatLiteral formats the argument as a literal,
+// str formats strings for the dialect.
+func formatLiteral(v interface{}, str func(string) string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return formatFloat(v)
+	case string:
+		return str(v), nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		return str(v.Format("2006-01-02 15:04:05.999999999Z07:00")), nil
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return "", errors.Wrap(err, "value")
+		}
+		return formatLiteral(value, str)
+	}
+
+	return "", errors.Errorf("unsupported value %T", v)
+}
+
+// formatFloat formats whole numbers without
+// exponent and fails on NaN and infinity.
+func formatFloat(v float64) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", errors.Errorf("unsupported number %v", v)
+	}
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64), nil
+}
+
+// quoteString quotes the string
+// doubling single quotes.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
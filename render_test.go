@@ -0,0 +1,168 @@
+package polluter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bindArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		args    []string
+		expect  string
+		wantErr bool
+	}{
+		{
+			name:   "question marks",
+			query:  "INSERT INTO `a?` (`b`) VALUES (?), (?);",
+			args:   []string{"1", "'?'"},
+			expect: "INSERT INTO `a?` (`b`) VALUES (1), ('?');",
+		},
+		{
+			name:   "numbered",
+			query:  `INSERT INTO "a$1" ("b""$2") VALUES ($2, $1);`,
+			args:   []string{"1", "2"},
+			expect: `INSERT INTO "a$1" ("b""$2") VALUES (2, 1);`,
+		},
+		{
+			name:    "not enough arguments",
+			query:   "VALUES (?, ?)",
+			args:    []string{"1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid placeholder",
+			query:   "VALUES ($2)",
+			args:    []string{"1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := bindArgs(tt.query, tt.args)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_dialectLiteral(t *testing.T) {
+	ts := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		dialect dialect
+		arg     interface{}
+		expect  string
+		wantErr bool
+	}{
+		{name: "null", dialect: postgresEngine{}, arg: nil, expect: "NULL"},
+		{name: "bool", dialect: postgresEngine{}, arg: true, expect: "TRUE"},
+		{name: "integer", dialect: postgresEngine{}, arg: float64(1000000), expect: "1000000"},
+		{name: "float", dialect: postgresEngine{}, arg: 1.5, expect: "1.5"},
+		{name: "postgres string", dialect: postgresEngine{}, arg: `it's \n`, expect: `'it''s \n'`},
+		{name: "postgres bytes", dialect: postgresEngine{}, arg: []byte("ab"), expect: `'\x6162'::bytea`},
+		{name: "postgres time", dialect: postgresEngine{}, arg: ts, expect: "'2019-01-02 03:04:05Z'"},
+		{name: "postgres array", dialect: postgresEngine{}, arg: pq.Array([]string{"a", "b"}), expect: `'{"a","b"}'`},
+		{name: "mysql string", dialect: mysqlEngine{}, arg: `it's \n`, expect: `'it''s \\n'`},
+		{name: "mysql time", dialect: mysqlEngine{}, arg: ts, expect: "'2019-01-02 03:04:05'"},
+		{name: "sqlite bytes", dialect: sqliteEngine{}, arg: []byte("ab"), expect: "X'6162'"},
+		{name: "unsupported", dialect: sqliteEngine{}, arg: struct{}{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.dialect.literal(tt.arg)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_renderSQL(t *testing.T) {
+	obj, err := yamlParser{}.Parse(strings.NewReader(`roles:
+- _ref: admin
+  name: Admin
+- _ref: user
+  id: 2
+  name: User
+users:
+- id: 1
+  name: Roman
+- id: 2
+  name: Dmitry
+  role_id: {$ref: admin.id}
+- id: 3
+  name: Alex
+  role_id: {$ref: user.id}
+`))
+	if err != nil {
+		assert.Nil(t, err)
+	}
+
+	e := postgresEngine{options: newSQLOptions([]SQLOption{PostgresCopy("users"), BatchSize(2), KeepSequences})}
+	cmds, err := e.Build(obj)
+	assert.Nil(t, err)
+
+	buf := new(bytes.Buffer)
+	err = e.Render(buf, cmds)
+	assert.Nil(t, err)
+	assert.Equal(t, `BEGIN;
+INSERT INTO "roles" ("name") VALUES ('Admin') RETURNING *;
+INSERT INTO "roles" ("id", "name") VALUES (2, 'User') RETURNING *;
+INSERT INTO "users" ("id", "name") VALUES (1, 'Roman');
+INSERT INTO "users" ("id", "name", "role_id") VALUES (2, 'Dmitry', (SELECT "id" FROM "roles" WHERE "name" = 'Admin')), (3, 'Alex', 2);
+COMMIT;
+`, buf.String())
+}
+
+func TestRender(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	p := New(SQLiteEngine(db))
+	cmds, err := p.Plan(strings.NewReader(`roles:
+- _ref: admin
+  name: Admin
+users:
+- id: 1
+  name: Roman
+  active: true
+  role_id: {$ref: admin.id}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, countRows(t, db, "users"))
+
+	buf := new(bytes.Buffer)
+	err = p.Render(buf, cmds)
+	assert.Nil(t, err)
+
+	_, err = db.Exec(buf.String())
+	assert.Nil(t, err)
+
+	var roleID int
+	err = db.QueryRow(`SELECT role_id FROM users WHERE id = 1 AND active = 1`).Scan(&roleID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, roleID)
+}
@@ -0,0 +1,575 @@
+package polluter
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// SQLConn is a database connection or transaction
+// owned by the caller, *sql.Tx and *sql.Conn
+// implement it.
+type SQLConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// SQLOption defines options for SQL engines.
+type SQLOption func(*sqlOptions)
+
+type sqlOptions struct {
+	strict     bool
+	arrays     bool
+	batchSize  int
+	packetSize int
+	copy       bool
+	copyTables map[string]bool
+	conflict   Conflict
+	// keepSequences disables sync of
+	// sequences after seeding.
+	keepSequences bool
+	order         bool
+	constraints   Constraints
+	validate      bool
+	// track makes records inserted one by one,
+	// so they're removed by cleanup.
+	track bool
+}
+
+func newSQLOptions(options []SQLOption) sqlOptions {
+	var o sqlOptions
+	for i := range options {
+		options[i](&o)
+	}
+	return o
+}
+
+// Strict option makes SQL engines fail on field
+// values which can't be mapped to a column
+// instead of skipping them.
+func Strict(o *sqlOptions) {
+	o.strict = true
+}
+
+// KeepSequences option disables sync of sequences
+// after seeding. By default Postgres engine sets
+// sequences owned by columns of seeded tables to
+// the max value of the column, so the following
+// inserts don't collide with seeded ids.
+func KeepSequences(o *sqlOptions) {
+	o.keepSequences = true
+}
+
+// BatchSize option makes SQL engines insert
+// consecutive records of the same table with the
+// same set of columns with multi-row INSERT
+// statements of up to n records. Batches are split
+// further to fit database limits on the number
+// of placeholders and the size of the statement.
+func BatchSize(n int) SQLOption {
+	return func(o *sqlOptions) {
+		o.batchSize = n
+	}
+}
+
+// MaxPacketSize option limits approximate size in
+// bytes of batched statements. MySQL engine uses
+// 4MB, the default of max_allowed_packet.
+func MaxPacketSize(n int) SQLOption {
+	return func(o *sqlOptions) {
+		o.packetSize = n
+	}
+}
+
+// dialect describes syntax differences
+// between SQL databases.
+type dialect interface {
+	quote(name string) string
+	placeholder(n int) string
+	// arg converts field value to the statement
+	// argument or returns errSkipField.
+	arg(value interface{}) (interface{}, error)
+	// returning reports whether labelled records
+	// are inserted with RETURNING clause, otherwise
+	// last insert id is used to resolve references.
+	returning() bool
+	// limits returns max number of placeholders and
+	// max size of the statement, zero means no limit.
+	limits() (args, size int)
+	// copy reports whether records of the
+	// table are loaded with COPY statement.
+	copy(table string) bool
+	// conflict returns INSERT verb and the clause
+	// appended to the statement to handle conflicts.
+	conflict(c conflictOption, columns []string, labelled bool) (verb, clause string, err error)
+	// primaryKey returns primary key columns of the table,
+	// it's used as conflict target if it isn't given.
+	primaryKey(table string) ([]string, error)
+	// foreignKeys maps tables of the schema
+	// to tables they refer to.
+	foreignKeys() (map[string][]string, error)
+	// truncate returns commands removing
+	// all records of the tables.
+	truncate(tables []string) Commands
+	// syncSequences returns commands which set
+	// sequences of the tables after seeding.
+	syncSequences(tables []string) Commands
+	// constraints returns commands which relax
+	// constraints before records are inserted
+	// and restore them after.
+	constraints(c Constraints) (relax, restore Commands)
+	// reset returns commands which restore settings of
+	// the session changed by relax and truncate commands,
+	// they're executed on the connection if commands fail.
+	reset() Commands
+	// checkConstraints fails if foreign keys are
+	// violated and ValidateConstraints option is set.
+	checkConstraints(ctx context.Context, conn SQLConn) error
+	// literal formats the argument as
+	// a literal of the statement.
+	literal(arg interface{}) (string, error)
+}
+
+// errSkipField is returned by dialect to skip
+// the field from the statement.
+var errSkipField = errors.New("skip field")
+
+// jsonArg converts field value to the argument,
+// nested objects and arrays are stored as JSON text.
+func jsonArg(value interface{}, o sqlOptions) (interface{}, error) {
+	if v, ok := value.(jwalk.Value); ok {
+		switch i := v.Interface().(type) {
+		case []interface{}, map[string]interface{}:
+		default:
+			return i, nil
+		}
+	}
+
+	m, ok := value.(json.Marshaler)
+	if !ok {
+		if o.strict {
+			return nil, errors.Errorf("unsupported value %T", value)
+		}
+		return nil, errSkipField
+	}
+
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal json")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, data); err != nil {
+		return nil, errors.Wrap(err, "compact json")
+	}
+	return buf.String(), nil
+}
+
+// sqlHandle returns connection owned by the caller
+// if it's given or the database, nil if none is set.
+func sqlHandle(db *sql.DB, conn SQLConn) SQLConn {
+	if conn != nil {
+		return conn
+	}
+	if db != nil {
+		return db
+	}
+	return nil
+}
+
+// queryColumns returns values of
+// the first column of the query.
+func queryColumns(conn SQLConn, q string, args ...interface{}) ([]string, error) {
+	if conn == nil {
+		return nil, errors.New("database isn't set")
+	}
+
+	rows, err := conn.QueryContext(context.Background(), q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, rows.Err()
+}
+
+// execSQL executes commands on the connection owned by
+// the caller if it's given, it's up to the caller to
+// commit or roll back changes then. Otherwise commands
+// are executed in a single transaction.
+func execSQL(ctx context.Context, d dialect, db *sql.DB, conn SQLConn, cmds []Command) error {
+	_, err := execTracked(ctx, d, db, conn, cmds)
+	return err
+}
+
+// execTracked is like execSQL but returns commands
+// removing records inserted by tracked commands,
+// the latest records are removed first.
+func execTracked(ctx context.Context, d dialect, db *sql.DB, conn SQLConn, cmds []Command) (Commands, error) {
+	if conn != nil {
+		cleanup, err := execConn(ctx, d, conn, cmds)
+		if err != nil {
+			if rErr := execReset(d, conn); rErr != nil {
+				err = errors.Wrap(rErr, err.Error())
+			}
+			return nil, err
+		}
+		return cleanup, nil
+	}
+	return execTx(ctx, d, db, cmds)
+}
+
+// execTx executes commands in a single transaction,
+// the transaction is rolled back if the context is done.
+// Settings of the session are reset on the connection
+// of the transaction if commands fail, the connection
+// is closed if they can't be reset.
+func execTx(ctx context.Context, d dialect, db *sql.DB, cmds []Command) (Commands, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "conn")
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "tx begin")
+	}
+
+	cleanup, err := execConn(ctx, d, tx, cmds)
+	if err != nil {
+		if rErr := tx.Rollback(); rErr != nil && rErr != sql.ErrTxDone {
+			err = errors.Wrap(rErr, err.Error())
+		}
+		if rErr := execReset(d, conn); rErr != nil {
+			conn.Raw(func(interface{}) error {
+				return driver.ErrBadConn
+			})
+			err = errors.Wrap(rErr, err.Error())
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "commit")
+	}
+	return cleanup, nil
+}
+
+// execReset executes reset commands of the dialect,
+// they run after the context of commands is done.
+func execReset(d dialect, conn SQLConn) error {
+	for _, c := range d.reset() {
+		if _, err := conn.ExecContext(context.Background(), c.Query, c.Args...); err != nil {
+			return errors.Wrap(err, "reset session")
+		}
+	}
+	return nil
+}
+
+// execConn executes commands one by one, resolves
+// references to labelled records and returns commands
+// removing records inserted by tracked commands.
+func execConn(ctx context.Context, d dialect, conn SQLConn, cmds []Command) (Commands, error) {
+	records := make(insertedRecords)
+	cleanup := make(Commands, 0)
+
+	for _, c := range cmds {
+		args, err := records.resolve(c.Args)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolve references")
+		}
+
+		if isCopy(c) {
+			if err := execCopy(ctx, conn, c.Query, len(c.Columns), args); err != nil {
+				return nil, errors.Wrap(err, "copy")
+			}
+			continue
+		}
+
+		rec := insertedRecord{
+			values: make(map[string]interface{}, len(args)),
+		}
+		for i, column := range c.Columns {
+			rec.values[column] = args[i]
+		}
+
+		// records which exist are kept by cleanup.
+		var existed bool
+		if c.track && len(c.target) > 0 {
+			if existed, err = recordExists(ctx, d, conn, c.table, c.target, rec.values); err != nil {
+				return nil, errors.Wrap(err, "select existing record")
+			}
+		}
+
+		inserted := true
+		switch {
+		case c.Label == "" && (!c.track || existed):
+			_, err = conn.ExecContext(ctx, c.Query, args...)
+		case d.returning():
+			inserted, err = queryReturning(ctx, conn, c.Query, args, rec.values)
+			if !inserted && err == nil && c.Label != "" {
+				err = errors.New("no rows returned")
+			}
+		default:
+			inserted, err = execInserted(ctx, d, conn, c, args, &rec)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "exec")
+		}
+
+		if c.Label != "" {
+			records[c.Label] = rec
+		}
+		if c.track && inserted && !existed {
+			cmd, err := deleteRecord(d, c, rec)
+			if err != nil {
+				return nil, errors.Wrap(err, "cleanup")
+			}
+			cleanup = append(Commands{cmd}, cleanup...)
+		}
+	}
+
+	if err := d.checkConstraints(ctx, conn); err != nil {
+		return nil, errors.Wrap(err, "validate constraints")
+	}
+	return cleanup, nil
+}
+
+// isCopy reports whether the command
+// is COPY statement of Postgres engine.
+func isCopy(c Command) bool {
+	return c.Label == "" && strings.HasPrefix(c.Query, "COPY ")
+}
+
+// execCopy executes COPY statement prepared with
+// pq.CopyIn, args are split into rows of n values.
+func execCopy(ctx context.Context, conn SQLConn, q string, n int, args []interface{}) error {
+	stmt, err := conn.PrepareContext(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "prepare")
+	}
+	defer stmt.Close()
+
+	for i := 0; i+n <= len(args) && n > 0; i += n {
+		if _, err := stmt.ExecContext(ctx, args[i:i+n]...); err != nil {
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+
+	return stmt.Close()
+}
+
+// queryReturning executes INSERT with RETURNING clause
+// or SELECT and scans the first row into values, it
+// reports whether the row is returned.
+func queryReturning(ctx context.Context, conn SQLConn, q string, args []interface{}, values map[string]interface{}) (bool, error) {
+	rows, err := conn.QueryContext(ctx, q, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, errors.Wrap(err, "columns")
+	}
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+
+	dest := make([]interface{}, len(columns))
+	for i := range dest {
+		dest[i] = new(interface{})
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return false, errors.Wrap(err, "scan")
+	}
+	for i, column := range columns {
+		values[column] = *(dest[i].(*interface{}))
+	}
+
+	return true, rows.Close()
+}
+
+// execInserted executes INSERT on engines without
+// RETURNING clause, keeps last insert id of the record
+// and reports whether the record is inserted. If the
+// labelled record isn't inserted because of a conflict,
+// the existing record is selected by the conflict target.
+func execInserted(ctx context.Context, d dialect, conn SQLConn, c Command, args []interface{}, rec *insertedRecord) (bool, error) {
+	res, err := conn.ExecContext(ctx, c.Query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "rows affected")
+	}
+	inserted := n == 1
+	if id, err := res.LastInsertId(); err == nil && id != 0 && inserted {
+		if len(c.key) == 1 {
+			rec.id, rec.key = id, c.key[0]
+		}
+		return true, nil
+	}
+	if c.Label == "" || inserted && len(c.target) == 0 {
+		return inserted, nil
+	}
+	if len(c.target) == 0 {
+		return false, errors.New("existing record can't be selected without conflict target")
+	}
+
+	return inserted, errors.Wrap(selectRecord(ctx, d, conn, c.table, c.target, rec), "select existing record")
+}
+
+// selectRecord selects the record by values of
+// the key columns and scans it into its values.
+func selectRecord(ctx context.Context, d dialect, conn SQLConn, table string, key []string, rec *insertedRecord) error {
+	conditions, args, ok := keyConditions(d, key, *rec)
+	if !ok {
+		return errors.Errorf("key %s isn't given", strings.Join(key, ", "))
+	}
+
+	q := fmt.Sprintf("SELECT * FROM %s WHERE %s", d.quote(table), conditions)
+	found, err := queryReturning(ctx, conn, q, args, rec.values)
+	if err == nil && !found {
+		err = errors.New("record isn't found")
+	}
+	return err
+}
+
+// recordExists reports whether the record with values
+// of the key columns exists, it doesn't if some of
+// the values aren't given.
+func recordExists(ctx context.Context, d dialect, conn SQLConn, table string, key []string, values map[string]interface{}) (bool, error) {
+	conditions, args, ok := keyConditions(d, key, insertedRecord{values: values})
+	if !ok {
+		return false, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE %s", d.quote(table), conditions), args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	return true, rows.Close()
+}
+
+// deleteRecord builds command removing the inserted
+// record by values of the primary key, or of all given
+// columns if the table has no primary key.
+func deleteRecord(d dialect, c Command, rec insertedRecord) (Command, error) {
+	key := c.key
+	if len(key) == 0 {
+		key = c.Columns
+	}
+
+	conditions, args, ok := keyConditions(d, key, rec)
+	if !ok {
+		return Command{}, errors.Errorf("%s: key %s isn't known", c.table, strings.Join(key, ", "))
+	}
+
+	return Command{
+		Query: fmt.Sprintf("DELETE FROM %s WHERE %s;", d.quote(c.table), conditions),
+		Args:  args,
+	}, nil
+}
+
+// keyConditions returns conditions matching values of
+// the key columns of the record and their arguments,
+// ok is false if some of the values aren't known.
+func keyConditions(d dialect, key []string, rec insertedRecord) (string, []interface{}, bool) {
+	conditions := make([]string, len(key))
+	args := make([]interface{}, 0, len(key))
+	for i, column := range key {
+		v, ok := rec.value(column)
+		if !ok {
+			return "", nil, false
+		}
+		if v == nil {
+			conditions[i] = fmt.Sprintf("%s IS NULL", d.quote(column))
+			continue
+		}
+		args = append(args, v)
+		conditions[i] = fmt.Sprintf("%s = %s", d.quote(column), d.placeholder(len(args)))
+	}
+
+	return strings.Join(conditions, " AND "), args, len(key) > 0
+}
+
+// insertedRecord holds values of the inserted record.
+type insertedRecord struct {
+	values map[string]interface{}
+	// id is the last insert id, it's the value of
+	// key, the generated primary key column.
+	id  interface{}
+	key string
+}
+
+// value returns the value of the column, last insert
+// id is the value of the generated key column.
+func (r insertedRecord) value(column string) (interface{}, bool) {
+	if v, ok := r.values[column]; ok {
+		return v, true
+	}
+	if r.id != nil && column == r.key {
+		return r.id, true
+	}
+	return nil, false
+}
+
+// insertedRecords maps labels to inserted records.
+type insertedRecords map[string]insertedRecord
+
+// resolve replaces references with values
+// of the inserted records.
+func (r insertedRecords) resolve(args []interface{}) ([]interface{}, error) {
+	resolved := make([]interface{}, len(args))
+	for i, arg := range args {
+		ref, ok := arg.(Ref)
+		if !ok {
+			resolved[i] = arg
+			continue
+		}
+
+		rec, ok := r[ref.Label]
+		if !ok {
+			return nil, errors.Errorf("unknown record %s", ref.Label)
+		}
+
+		v, ok := rec.value(ref.Column)
+		if !ok {
+			return nil, errors.Errorf("unknown column %s", ref)
+		}
+		resolved[i] = v
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,222 @@
+package polluter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/romanyx/jwalk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_insertedRecords_resolve(t *testing.T) {
+	records := insertedRecords{
+		"admin": insertedRecord{
+			values: map[string]interface{}{
+				"name": "Admin",
+			},
+			id:  int64(3),
+			key: "id",
+		},
+		"guest": insertedRecord{
+			values: map[string]interface{}{
+				"id": int64(1),
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		args    []interface{}
+		expect  []interface{}
+		wantErr bool
+	}{
+		{
+			name:   "explicit value",
+			args:   []interface{}{"Roman", Ref{"admin", "name"}},
+			expect: []interface{}{"Roman", "Admin"},
+		},
+		{
+			name:   "last insert id",
+			args:   []interface{}{Ref{"admin", "id"}},
+			expect: []interface{}{int64(3)},
+		},
+		{
+			name:    "unknown column",
+			args:    []interface{}{Ref{"guest", "name"}},
+			wantErr: true,
+		},
+		{
+			name:    "column without last insert id",
+			args:    []interface{}{Ref{"admin", "created"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown record",
+			args:    []interface{}{Ref{"user", "id"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := records.resolve(tt.args)
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_jsonArg(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		options []SQLOption
+		expect  interface{}
+		wantErr error
+	}{
+		{
+			name:   "nested object",
+			value:  jsonObject(`{"key": {"nested": [1, 2]}}`),
+			expect: `{"key":{"nested":[1,2]}}`,
+		},
+		{
+			name:    "unsupported value",
+			value:   struct{}{},
+			wantErr: errSkipField,
+		},
+		{
+			name:    "strict unsupported value",
+			value:   struct{}{},
+			options: []SQLOption{Strict},
+			wantErr: errors.New("unsupported value struct {}"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := jsonArg(tt.value, newSQLOptions(tt.options))
+
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func jsonObject(s string) jwalk.ObjectWalker {
+	i, err := jwalk.Parse([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return i.(jwalk.ObjectWalker)
+}
+
+// lastInsertIDDialect makes SQLite resolve
+// references with last insert id.
+type lastInsertIDDialect struct {
+	sqliteEngine
+}
+
+func (d lastInsertIDDialect) returning() bool {
+	return false
+}
+
+func Test_execConn_lastInsertID(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	obj, err := yamlParser{}.Parse(strings.NewReader(`roles:
+- _ref: admin
+  name: Admin
+users:
+- id: 1
+  name: Roman
+  role_id: {$ref: admin.id}
+`))
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	d := lastInsertIDDialect{sqliteEngine{db: db}}
+	cmds, err := buildInserts(d, d.options, obj)
+	if err != nil {
+		t.Fatalf("build: %s", err)
+	}
+	assert.Equal(t, `INSERT INTO "roles" ("name") VALUES (?);`, cmds[0].Query)
+	assert.Equal(t, []string{"id"}, cmds[0].key)
+
+	// the primary key is resolved at build time, so
+	// the transaction doesn't wait for the pool.
+	db.SetMaxOpenConns(1)
+	_, err = execTx(context.Background(), d, db, cmds)
+	assert.Nil(t, err)
+
+	var roleID int
+	err = db.QueryRow(`SELECT role_id FROM users WHERE id = 1`).Scan(&roleID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, roleID)
+
+	obj, err = yamlParser{}.Parse(strings.NewReader(`roles:
+- _ref: user
+  name: User
+users:
+- id: 2
+  name: Dmitry
+  role_id: {$ref: user.typo}
+`))
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	cmds, err = buildInserts(d, d.options, obj)
+	if err != nil {
+		t.Fatalf("build: %s", err)
+	}
+	_, err = execConn(context.Background(), d, db, cmds)
+	assert.EqualError(t, err, "resolve references: unknown column user.typo")
+}
+
+// resetDialect makes SQLite reset the
+// session by setting user_version.
+type resetDialect struct {
+	sqliteEngine
+}
+
+func (d resetDialect) reset() Commands {
+	return Commands{Command{Query: "PRAGMA user_version = 7;"}}
+}
+
+func Test_execTx_reset(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	_, err := execTx(context.Background(), resetDialect{}, db, Commands{
+		Command{Query: `INSERT INTO roles (name) VALUES (?);`, Args: []interface{}{"Admin"}},
+		Command{Query: `INSERT INTO missing (name) VALUES (?);`, Args: []interface{}{"Admin"}},
+	})
+	assert.NotNil(t, err)
+
+	var version int
+	err = db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, version)
+	assert.Equal(t, 0, countRows(t, db, "roles"))
+}
@@ -0,0 +1,180 @@
+package polluter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+type sqliteEngine struct {
+	db      *sql.DB
+	conn    SQLConn
+	options sqlOptions
+}
+
+func (e sqliteEngine) Exec(cmds []Command) error {
+	return e.ExecContext(context.Background(), cmds)
+}
+
+func (e sqliteEngine) ExecContext(ctx context.Context, cmds []Command) error {
+	return execSQL(ctx, e, e.db, e.conn, cmds)
+}
+
+func (e sqliteEngine) Build(obj jwalk.ObjectWalker) (Commands, error) {
+	return buildInserts(e, e.options, obj)
+}
+
+func (e sqliteEngine) BuildTruncate(obj jwalk.ObjectWalker) (Commands, error) {
+	return buildTruncate(e, obj)
+}
+
+// BuildTracked builds inserts of records one by one
+// with their keys, so they're removed by cleanup.
+func (e sqliteEngine) BuildTracked(obj jwalk.ObjectWalker) (Commands, error) {
+	o := e.options
+	o.track = true
+	return buildInserts(e, o, obj)
+}
+
+func (e sqliteEngine) ExecTracked(ctx context.Context, cmds []Command) (Commands, error) {
+	return execTracked(ctx, e, e.db, e.conn, cmds)
+}
+
+func (e sqliteEngine) Verify(ctx context.Context, obj jwalk.ObjectWalker) (Diff, error) {
+	return verifySQL(ctx, e, sqlHandle(e.db, e.conn), obj)
+}
+
+func (e sqliteEngine) Export(ctx context.Context, sources []Source) (Document, error) {
+	return exportSQL(ctx, e, sqlHandle(e.db, e.conn), sources)
+}
+
+func (e sqliteEngine) quote(name string) string {
+	return escape(name)
+}
+
+// returning is supported since SQLite 3.35.0,
+// last_insert_rowid isn't changed by records
+// updated on conflict.
+func (e sqliteEngine) returning() bool {
+	return true
+}
+
+// limits of SQLITE_MAX_VARIABLE_NUMBER
+// since SQLite 3.32.0.
+func (e sqliteEngine) limits() (int, int) {
+	return 32766, 0
+}
+
+func (e sqliteEngine) conflict(c conflictOption, columns []string, labelled bool) (string, string, error) {
+	clause, err := onConflictClause(e, c, columns, labelled)
+	return "INSERT", clause, err
+}
+
+// truncate deletes records with foreign key
+// checks deferred till the end of the transaction.
+func (e sqliteEngine) truncate(tables []string) Commands {
+	cmds := Commands{
+		Command{Query: "PRAGMA defer_foreign_keys = ON;"},
+	}
+	for _, t := range tables {
+		cmds = append(cmds, Command{Query: fmt.Sprintf("DELETE FROM %s;", e.quote(t))})
+	}
+
+	return cmds
+}
+
+// syncSequences does nothing since SQLite keeps
+// the largest id of AUTOINCREMENT tables itself.
+func (e sqliteEngine) syncSequences(_ []string) Commands {
+	return nil
+}
+
+func (e sqliteEngine) primaryKey(table string) ([]string, error) {
+	return queryColumns(sqlHandle(e.db, e.conn), `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table)
+}
+
+func (e sqliteEngine) foreignKeys() (map[string][]string, error) {
+	return queryForeignKeys(sqlHandle(e.db, e.conn), `
+SELECT DISTINCT m.name, p."table"
+FROM sqlite_master m
+JOIN pragma_foreign_key_list(m.name) p
+WHERE m.type = 'table'
+ORDER BY 1, 2`)
+}
+
+// constraints defers foreign keys for both modes,
+// SQLite ignores foreign_keys pragma within
+// a transaction.
+func (e sqliteEngine) constraints(_ Constraints) (Commands, Commands) {
+	return Commands{Command{Query: "PRAGMA defer_foreign_keys = ON;"}},
+		Commands{Command{Query: "PRAGMA defer_foreign_keys = OFF;"}}
+}
+
+// reset does nothing since defer_foreign_keys
+// is reset at the end of the transaction.
+func (e sqliteEngine) reset() Commands {
+	return nil
+}
+
+// checkConstraints uses foreign_key_check pragma,
+// which returns a row for every violation.
+func (e sqliteEngine) checkConstraints(ctx context.Context, conn SQLConn) error {
+	if !e.options.validate {
+		return nil
+	}
+
+	rows, err := conn.QueryContext(ctx, "PRAGMA foreign_key_check;")
+	if err != nil {
+		return errors.Wrap(err, "foreign key check")
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var (
+			table, parent string
+			rowID, fkID   interface{}
+		)
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return errors.Wrap(err, "scan")
+		}
+		return errors.Errorf("foreign key %v of %s is violated", fkID, table)
+	}
+
+	return rows.Err()
+}
+
+func (e sqliteEngine) Render(w io.Writer, cmds Commands) error {
+	return renderSQL(w, e, cmds)
+}
+
+func (e sqliteEngine) literal(arg interface{}) (string, error) {
+	return formatLiteral(arg, quoteString)
+}
+
+func (e sqliteEngine) copy(_ string) bool {
+	return false
+}
+
+func (e sqliteEngine) placeholder(_ int) string {
+	return "?"
+}
+
+// arg stores booleans as integers, nested
+// objects and arrays as JSON text since
+// SQLite has no dedicated types for them.
+func (e sqliteEngine) arg(value interface{}) (interface{}, error) {
+	if v, ok := value.(jwalk.Value); ok {
+		if b, ok := v.Interface().(bool); ok {
+			if b {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	return jsonArg(value, e.options)
+}
@@ -0,0 +1,263 @@
+package polluter
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const sqliteSchema = `
+CREATE TABLE roles (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	name varchar(255) NOT NULL
+);
+CREATE TABLE users (
+	id integer NOT NULL,
+	name varchar(255) NOT NULL,
+	active boolean NOT NULL DEFAULT 0,
+	meta text,
+	role_id integer REFERENCES roles (id)
+);
+CREATE TABLE "all" (
+	"group" varchar(255) NOT NULL
+);
+`
+
+func Test_sqliteEngine_build(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []byte
+		expect Commands
+	}{
+		{
+			name:  "example input",
+			input: []byte(`{"users":[{"id":1,"name":"Roman","active":true},{"id":2,"name":"Dmitry","active":false}],"roles":[{"id":2,"role_ids":[1,2],"meta":{"key":"value"}}]}`),
+			expect: Commands{
+				Command{
+					Query: `INSERT INTO "users" ("id", "name", "active") VALUES (?, ?, ?);`,
+					Args: []interface{}{
+						float64(1),
+						"Roman",
+						1,
+					},
+				},
+				Command{
+					Query: `INSERT INTO "users" ("id", "name", "active") VALUES (?, ?, ?);`,
+					Args: []interface{}{
+						float64(2),
+						"Dmitry",
+						0,
+					},
+				},
+				Command{
+					Query: `INSERT INTO "roles" ("id", "role_ids", "meta") VALUES (?, ?, ?);`,
+					Args: []interface{}{
+						float64(2),
+						"[1,2]",
+						`{"key":"value"}`,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(bytes.NewReader(tt.input))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			e := sqliteEngine{}
+			got, err := e.Build(obj)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func Test_sqliteEngine_exec(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []Command
+		wantErr bool
+	}{
+		{
+			name: "valid query",
+			args: []Command{
+				Command{
+					Query: `INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+					Args: []interface{}{
+						1,
+						"Roman",
+					},
+				},
+			},
+		},
+		{
+			name: "invalid query",
+			args: []Command{
+				Command{
+					Query: `INSERT INTO "users" ("id", "name") VALUES (?, ?);`,
+					Args: []interface{}{
+						1,
+						"Roman",
+					},
+				},
+				Command{
+					Query: `INSERT INTO "groups" ("id", "name") VALUES (?, ?);`,
+					Args: []interface{}{
+						1,
+						"User",
+					},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, teardown := prepareSQLiteDB(t)
+			defer teardown()
+			e := sqliteEngine{db: db}
+
+			err := e.Exec(tt.args)
+
+			if tt.wantErr && err == nil {
+				assert.NotNil(t, err)
+				return
+			}
+
+			if !tt.wantErr && err != nil {
+				assert.Nil(t, err)
+			}
+
+			var count int
+			if err := db.QueryRow(`SELECT count(*) FROM "users"`).Scan(&count); err != nil {
+				assert.Nil(t, err)
+			}
+
+			if tt.wantErr {
+				assert.Equal(t, 0, count, "transaction should be rolled back")
+			}
+		})
+	}
+}
+
+func TestSQLiteEngine(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	p := New(SQLiteEngine(db), JSONParser)
+	err := p.Pollute(strings.NewReader(`{"users":[{"id":1,"name":"Roman","active":true,"meta":{"key":"value"}}],"all":[{"group":"first"}]}`))
+	assert.Nil(t, err)
+
+	var (
+		name   string
+		active bool
+		meta   string
+	)
+	err = db.QueryRow(`SELECT name, active, meta FROM users WHERE id = 1`).Scan(&name, &active, &meta)
+	assert.Nil(t, err)
+	assert.Equal(t, "Roman", name)
+	assert.True(t, active)
+	assert.Equal(t, `{"key":"value"}`, meta)
+}
+
+func TestSQLiteEngineRefs(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	if _, err := db.Exec(`INSERT INTO roles (name) VALUES ('Guest')`); err != nil {
+		t.Fatalf("insert role: %s", err)
+	}
+
+	p := New(SQLiteEngine(db, BatchSize(10)))
+	err := p.Pollute(strings.NewReader(`roles:
+- _ref: admin_role
+  name: Admin
+users:
+- id: 1
+  name: Roman
+  role_id: {$ref: admin_role.id}
+- id: 2
+  name: Dmitry
+  role_id: {$ref: admin_role.id}
+`))
+	assert.Nil(t, err)
+
+	rows, err := db.Query(`SELECT u.name, r.name FROM users u JOIN roles r ON r.id = u.role_id ORDER BY u.id`)
+	if err != nil {
+		t.Fatalf("select users: %s", err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var user, role string
+		if err := rows.Scan(&user, &role); err != nil {
+			t.Fatalf("scan: %s", err)
+		}
+		got = append(got, user+":"+role)
+	}
+	assert.Equal(t, []string{"Roman:Admin", "Dmitry:Admin"}, got)
+}
+
+func TestSQLiteTxEngine(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin tx: %s", err)
+	}
+
+	p := New(SQLiteTxEngine(tx))
+	err = p.Pollute(strings.NewReader(input))
+	assert.Nil(t, err)
+
+	var count int
+	err = tx.QueryRow(`SELECT count(*) FROM users`).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	assert.Nil(t, tx.Rollback())
+	err = db.QueryRow(`SELECT count(*) FROM users`).Scan(&count)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM ` + escape(table)).Scan(&count); err != nil {
+		t.Fatalf("count %s: %s", table, err)
+	}
+	return count
+}
+
+func prepareSQLiteDB(t *testing.T) (db *sql.DB, teardown func() error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		log.Fatalf("open sqlite connection: %s", err)
+	}
+	// every connection gets its own in-memory database.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		log.Fatalf("create sqlite schema: %s", err)
+	}
+
+	return db, db.Close
+}
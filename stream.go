@@ -0,0 +1,224 @@
+package polluter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// defaultStreamCommit is the number of records
+// of the stream committed at once by default.
+const defaultStreamCommit = 1000
+
+// StreamCommit option sets the number of records
+// PolluteStream builds and executes at once.
+func StreamCommit(n int) Option {
+	return func(p *Polluter) {
+		p.streamCommit = n
+	}
+}
+
+// streamLine is a single record of the stream.
+type streamLine struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// PolluteStream seeds records of NDJSON input
+// given as a record per line:
+//
+//	{"table": "roles", "row": {"_ref": "admin", "name": "Admin"}}
+//	{"table": "users", "row": {"name": "Roman", "role_id": {"$ref": "admin.id"}}}
+//
+// Records are parsed, built and executed in chunks of
+// StreamCommit records, 1000 by default, so memory used
+// doesn't depend on the size of the input. Engines which
+// implement ExecerContext commit every chunk, if seeding
+// fails records of previous chunks stay in a database.
+// References resolve to labelled records of the same
+// chunk only, a reference to the record of a previous
+// chunk and a label repeated across chunks are errors,
+// so results don't depend on StreamCommit. Truncate
+// option removes records of tables when they first
+// appear in the stream. Records of
+// the stream aren't tracked by TrackCleanup option.
+func (p *Polluter) PolluteStream(r io.Reader) error {
+	return p.PolluteStreamContext(context.Background(), r)
+}
+
+// PolluteStreamContext is like PolluteStream but stops
+// reading of the input and execution of commands when
+// the context is done. Only the chunk being executed is
+// rolled back then.
+func (p *Polluter) PolluteStreamContext(ctx context.Context, r io.Reader) error {
+	size := p.streamCommit
+	if size <= 0 {
+		size = defaultStreamCommit
+	}
+
+	s := streamer{
+		p:      p,
+		ctx:    ctx,
+		tables: make(map[string]bool),
+		labels: make(map[string]int),
+		chunk:  make(map[string]int),
+	}
+	br := bufio.NewReader(contextReader{ctx, r})
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return contextError(ctx, errors.Wrap(err, "read from input"))
+		}
+
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := s.add(data, line); err != nil {
+				return contextError(ctx, errors.Wrapf(err, "line %d", line))
+			}
+			if s.count == size {
+				if err := s.flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return s.flush()
+		}
+	}
+}
+
+// streamer collects records of the chunk,
+// consecutive records of the same table go
+// to the same key of the document.
+type streamer struct {
+	p      *Polluter
+	ctx    context.Context
+	doc    docObject
+	count  int
+	first  int
+	last   int
+	tables map[string]bool
+	// labels are lines of labelled records of
+	// previous chunks, chunk of the current one.
+	labels map[string]int
+	chunk  map[string]int
+}
+
+// add adds the record given at the line to the chunk.
+func (s *streamer) add(data []byte, line int) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var l streamLine
+	if err := dec.Decode(&l); err != nil {
+		return errors.Wrap(err, "parse failed")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after record")
+	}
+	if l.Table == "" {
+		return errors.New("table isn't set")
+	}
+	if len(l.Row) == 0 {
+		return errors.New("row isn't set")
+	}
+
+	i, err := jwalk.Parse(l.Row)
+	if err != nil {
+		return errors.Wrap(err, "parse failed")
+	}
+	row, ok := i.(jwalk.ObjectWalker)
+	if !ok {
+		return errors.New("row must be an object")
+	}
+
+	if err := s.checkLabels(row, line); err != nil {
+		return err
+	}
+
+	if n := len(s.doc); n > 0 && s.doc[n-1].name == l.Table {
+		s.doc[n-1].value = append(s.doc[n-1].value.(docObjects), row)
+	} else {
+		s.doc = append(s.doc, docField{l.Table, docObjects{row}})
+	}
+	if s.count == 0 {
+		s.first = line
+	}
+	s.last = line
+	s.count++
+
+	return nil
+}
+
+// checkLabels reports references to records of
+// previous chunks and labels given before.
+func (s *streamer) checkLabels(row jwalk.ObjectWalker, line int) error {
+	return row.Walk(func(name string, value interface{}) error {
+		if name == labelField {
+			v, ok := value.(jwalk.Value)
+			if !ok {
+				return errors.Errorf("%s must be a string", labelField)
+			}
+			label := v.String()
+			if prev, ok := s.labels[label]; ok {
+				return errors.Errorf("duplicate record label %s, given at line %d", label, prev)
+			}
+			if _, ok := s.chunk[label]; !ok {
+				s.chunk[label] = line
+			}
+			return nil
+		}
+
+		ref, ok, err := parseRef(value)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+		if !ok {
+			return nil
+		}
+		if _, ok := s.chunk[ref.Label]; ok {
+			return nil
+		}
+		if prev, ok := s.labels[ref.Label]; ok {
+			return errors.Errorf("%s: reference to record %s of a previous chunk, given at line %d", name, ref.Label, prev)
+		}
+		return nil
+	})
+}
+
+// flush seeds records of the chunk, tables which
+// weren't seen before are truncated if it's enabled.
+func (s *streamer) flush() error {
+	if s.count == 0 {
+		return nil
+	}
+
+	var truncated docObject
+	for _, f := range s.doc {
+		if !s.tables[f.name] {
+			s.tables[f.name] = true
+			truncated = append(truncated, docField{f.name, docValue{[]interface{}{}}})
+		}
+	}
+
+	// records of streams aren't tracked, so
+	// memory doesn't grow with the input.
+	var err error
+	if len(truncated) > 0 {
+		err = s.p.pollute(s.ctx, s.doc, truncated, false)
+	} else {
+		err = s.p.pollute(s.ctx, s.doc, nil, false)
+	}
+	s.doc, s.count = nil, 0
+	for label, line := range s.chunk {
+		s.labels[label] = line
+		delete(s.chunk, label)
+	}
+
+	return errors.Wrapf(err, "lines %d-%d", s.first, s.last)
+}
@@ -0,0 +1,147 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolluter_PolluteStream_chunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		execs   int
+		wantErr string
+	}{
+		{
+			name: "chunks",
+			input: `{"table":"roles","row":{"name":"Admin"}}
+{"table":"users","row":{"name":"Roman"}}
+
+{"table":"users","row":{"name":"Dmitry"}}
+{"table":"users","row":{"name":"Alex"}}
+{"table":"users","row":{"name":"Anna"}}`,
+			execs: 3,
+		},
+		{
+			name: "references of the chunk",
+			input: `{"table":"roles","row":{"_ref":"admin","name":"Admin"}}
+{"table":"users","row":{"name":"Roman","role_id":{"$ref":"admin.id"}}}`,
+			execs: 1,
+		},
+		{
+			name: "reference across chunks",
+			input: `{"table":"roles","row":{"_ref":"admin","name":"Admin"}}
+{"table":"roles","row":{"name":"User"}}
+{"table":"users","row":{"name":"Roman","role_id":{"$ref":"admin.id"}}}`,
+			wantErr: "line 3: role_id: reference to record admin of a previous chunk, given at line 1",
+		},
+		{
+			name: "label across chunks",
+			input: `{"table":"roles","row":{"_ref":"admin","name":"Admin"}}
+{"table":"roles","row":{"name":"User"}}
+{"table":"roles","row":{"_ref":"admin","name":"Root"}}`,
+			wantErr: "line 3: duplicate record label admin, given at line 1",
+		},
+		{
+			name:  "empty input",
+			input: "\n\n",
+		},
+		{
+			name:    "invalid json",
+			input:   "{\"table\":\"users\",\"row\":{\"name\":\"Roman\"}}\n{\"table\":\n",
+			wantErr: "line 2: parse failed",
+		},
+		{
+			name:    "unknown field",
+			input:   `{"table":"users","rows":{}}`,
+			wantErr: "line 1: parse failed",
+		},
+		{
+			name:    "no table",
+			input:   `{"row":{"name":"Roman"}}`,
+			wantErr: "line 1: table isn't set",
+		},
+		{
+			name:    "no row",
+			input:   `{"table":"users"}`,
+			wantErr: "line 1: row isn't set",
+		},
+		{
+			name:    "invalid row",
+			input:   `{"table":"users","row":[1]}`,
+			wantErr: "line 1: row must be an object",
+		},
+		{
+			name:    "several records",
+			input:   `{"table":"users","row":{}} {"table":"users","row":{}}`,
+			wantErr: "line 1: unexpected data after record",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var execs int
+			p := New(
+				WithEngine(engineFunc(func([]Command) error {
+					execs++
+					return nil
+				})),
+				StreamCommit(2),
+			)
+
+			err := p.PolluteStream(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.execs, execs)
+		})
+	}
+}
+
+func TestPolluter_PolluteStream(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	err := New(SQLiteEngine(db), StreamCommit(2)).PolluteStream(strings.NewReader(`{"table":"roles","row":{"_ref":"admin","name":"Admin"}}
+{"table":"users","row":{"id":1,"name":"Roman","role_id":{"$ref":"admin.id"}}}
+{"table":"users","row":{"id":2,"name":"Dmitry"}}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "roles"))
+	assert.Equal(t, 2, countRows(t, db, "users"))
+
+	err = New(SQLiteEngine(db), StreamCommit(2)).PolluteStream(strings.NewReader(`{"table":"roles","row":{"name":"User"}}
+{"table":"roles","row":{"name":"Guest"}}
+{"table":"users","row":{"id":3}}
+`))
+	if assert.NotNil(t, err, "record without required field should fail") {
+		assert.Contains(t, err.Error(), "lines 3-3")
+	}
+	assert.Equal(t, 3, countRows(t, db, "roles"), "records of committed chunks should stay")
+	assert.Equal(t, 2, countRows(t, db, "users"))
+
+	err = New(SQLiteEngine(db), Truncate, StreamCommit(1)).PolluteStream(strings.NewReader(`{"table":"users","row":{"id":4,"name":"Alex"}}
+{"table":"users","row":{"id":5,"name":"Anna"}}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, countRows(t, db, "users"), "tables should be truncated once")
+
+	p := New(SQLiteEngine(db), TrackCleanup, StreamCommit(2))
+	var stream strings.Builder
+	for i := 0; i < 10; i++ {
+		stream.WriteString(`{"table":"roles","row":{"name":"Stream"}}` + "\n")
+	}
+	err = p.PolluteStream(strings.NewReader(stream.String()))
+	assert.Nil(t, err)
+	assert.Equal(t, 13, countRows(t, db, "roles"))
+	assert.Empty(t, p.cleanup, "records of streams should not be tracked")
+}
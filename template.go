@@ -0,0 +1,313 @@
+package polluter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateOption defines options of templates.
+type TemplateOption func(*templateOptions)
+
+type templateOptions struct {
+	seed int64
+	// seeded is set by TemplateSeed, otherwise
+	// seed is chosen on every execution.
+	seeded bool
+	now    time.Time
+	data   interface{}
+	funcs  template.FuncMap
+}
+
+// TemplateSeed option makes random functions of
+// templates return the same values on every run.
+func TemplateSeed(seed int64) TemplateOption {
+	return func(o *templateOptions) {
+		o.seed, o.seeded = seed, true
+	}
+}
+
+// TemplateNow option sets time
+// returned by now function.
+func TemplateNow(t time.Time) TemplateOption {
+	return func(o *templateOptions) {
+		o.now = t
+	}
+}
+
+// TemplateData option sets data
+// templates are executed with.
+func TemplateData(data interface{}) TemplateOption {
+	return func(o *templateOptions) {
+		o.data = data
+	}
+}
+
+// TemplateFuncs option adds functions to templates,
+// they override functions with the same names.
+func TemplateFuncs(funcs template.FuncMap) TemplateOption {
+	return func(o *templateOptions) {
+		if o.funcs == nil {
+			o.funcs = make(template.FuncMap)
+		}
+		for name, fn := range funcs {
+			o.funcs[name] = fn
+		}
+	}
+}
+
+// Templates option makes Polluter execute input as
+// text/template before parsing. Besides builtin
+// functions templates are able to use:
+//
+//	seq "users"          next number of the named sequence, from 1
+//	times 3              numbers from 0 to 2 to range over
+//	int 1 10             random integer in the range
+//	float 0 1            random number in the range
+//	bool                 random boolean
+//	pick "a" "b"         random item
+//	uuid                 random UUID
+//	firstName, lastName  random names
+//	name, username       random full name and user name
+//	email                random email
+//	now                  current time or time of TemplateNow
+//	date "2006-01-02" "2019-01-02"  parsed time
+//	addDate 0 1 0 t      time with years, months and days added
+//	randomDate from to   random time between times
+//	formatTime "2006-01-02" t       formatted time
+//	md5, sha1, sha256    hex encoded hash of the string
+//	base64               base64 encoded string
+//
+// Random functions return different values on
+// every run unless TemplateSeed option is given.
+func Templates(options ...TemplateOption) Option {
+	var o templateOptions
+	for i := range options {
+		options[i](&o)
+	}
+
+	return func(p *Polluter) {
+		p.template = &o
+	}
+}
+
+// execute executes the input as the template.
+func (o *templateOptions) execute(r io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read from input")
+	}
+
+	t, err := template.New("input").
+		Option("missingkey=error").
+		Funcs(o.newFuncs()).
+		Parse(string(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, o.data); err != nil {
+		return nil, errors.Wrap(err, "execute")
+	}
+
+	return buf, nil
+}
+
+// newFuncs returns functions with their own random
+// source and sequences, so every run of the same
+// templates returns the same values for the seed.
+// The seed is random if it isn't set.
+func (o *templateOptions) newFuncs() template.FuncMap {
+	seed := o.seed
+	if !o.seeded {
+		seed = time.Now().UnixNano()
+	}
+
+	f := fakeFuncs{
+		rand: rand.New(rand.NewSource(seed)),
+		now:  o.now,
+		seqs: make(map[string]int),
+	}
+
+	funcs := template.FuncMap{
+		"seq":        f.seq,
+		"times":      times,
+		"int":        f.int,
+		"float":      f.float,
+		"bool":       f.bool,
+		"pick":       f.pick,
+		"uuid":       f.uuid,
+		"firstName":  f.firstName,
+		"lastName":   f.lastName,
+		"name":       f.name,
+		"username":   f.username,
+		"email":      f.email,
+		"now":        f.currentTime,
+		"date":       parseDate,
+		"addDate":    addDate,
+		"randomDate": f.randomDate,
+		"formatTime": formatTime,
+		"md5":        hashMD5,
+		"sha1":       hashSHA1,
+		"sha256":     hashSHA256,
+		"base64":     encodeBase64,
+	}
+	for name, fn := range o.funcs {
+		funcs[name] = fn
+	}
+
+	return funcs
+}
+
+var (
+	firstNames = []string{
+		"Alex", "Anna", "Boris", "Daria", "Dmitry", "Elena", "Ivan", "Julia",
+		"Kate", "Maria", "Max", "Nick", "Olga", "Paul", "Roman", "Sofia",
+	}
+	lastNames = []string{
+		"Brown", "Davis", "Garcia", "Ivanov", "Jones", "Miller", "Petrov", "Smith",
+		"Taylor", "Wilson",
+	}
+	emailDomains = []string{"example.com", "example.org", "example.net"}
+)
+
+// fakeFuncs generates values for templates.
+type fakeFuncs struct {
+	rand *rand.Rand
+	now  time.Time
+	seqs map[string]int
+}
+
+func (f fakeFuncs) seq(name string) int {
+	f.seqs[name]++
+	return f.seqs[name]
+}
+
+func (f fakeFuncs) int(min, max int) (int, error) {
+	if max < min {
+		return 0, errors.Errorf("invalid range %d..%d", min, max)
+	}
+	return min + f.rand.Intn(max-min+1), nil
+}
+
+func (f fakeFuncs) float(min, max float64) float64 {
+	return min + f.rand.Float64()*(max-min)
+}
+
+func (f fakeFuncs) bool() bool {
+	return f.rand.Intn(2) == 1
+}
+
+func (f fakeFuncs) pick(items ...interface{}) (interface{}, error) {
+	if len(items) == 0 {
+		return nil, errors.New("nothing to pick")
+	}
+	return items[f.rand.Intn(len(items))], nil
+}
+
+func (f fakeFuncs) uuid() string {
+	var b [16]byte
+	f.rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (f fakeFuncs) firstName() string {
+	return firstNames[f.rand.Intn(len(firstNames))]
+}
+
+func (f fakeFuncs) lastName() string {
+	return lastNames[f.rand.Intn(len(lastNames))]
+}
+
+func (f fakeFuncs) name() string {
+	return f.firstName() + " " + f.lastName()
+}
+
+func (f fakeFuncs) username() string {
+	return strings.ToLower(f.firstName()) + fmt.Sprint(f.rand.Intn(10000))
+}
+
+func (f fakeFuncs) email() string {
+	return fmt.Sprintf(
+		"%s.%s%d@%s",
+		strings.ToLower(f.firstName()),
+		strings.ToLower(f.lastName()),
+		f.rand.Intn(10000),
+		emailDomains[f.rand.Intn(len(emailDomains))],
+	)
+}
+
+func (f fakeFuncs) currentTime() time.Time {
+	if f.now.IsZero() {
+		return time.Now().UTC()
+	}
+	return f.now
+}
+
+func (f fakeFuncs) randomDate(from, to time.Time) (time.Time, error) {
+	d := to.Sub(from)
+	if d < 0 {
+		return time.Time{}, errors.Errorf("invalid range %s..%s", from, to)
+	}
+	if d == 0 {
+		return from, nil
+	}
+	return from.Add(time.Duration(f.rand.Int63n(int64(d)))), nil
+}
+
+func times(n int) []int {
+	if n < 0 {
+		n = 0
+	}
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func parseDate(layout, value string) (time.Time, error) {
+	return time.Parse(layout, value)
+}
+
+func addDate(years, months, days int, t time.Time) time.Time {
+	return t.AddDate(years, months, days)
+}
+
+func formatTime(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+func hashMD5(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashSHA1(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func encodeBase64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
@@ -0,0 +1,142 @@
+package polluter
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_templateOptions_execute(t *testing.T) {
+	now := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		options []TemplateOption
+		input   string
+		expect  string
+		wantErr bool
+	}{
+		{
+			name:   "sequence",
+			input:  `{{seq "users"}} {{seq "users"}} {{seq "roles"}}`,
+			expect: "1 2 1",
+		},
+		{
+			name:    "dates",
+			options: []TemplateOption{TemplateNow(now)},
+			input:   `{{now | addDate 0 1 0 | formatTime "2006-01-02"}} {{date "2006-01-02" "2019-05-06" | formatTime "Jan 2"}}`,
+			expect:  "2019-02-02 May 6",
+		},
+		{
+			name:   "hashing",
+			input:  `{{md5 "secret"}} {{sha1 "secret"}} {{sha256 "secret"}} {{base64 "secret"}}`,
+			expect: "5ebe2294ecd0e0f08eab7690d2a6ee69 e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b c2VjcmV0",
+		},
+		{
+			name: "data and functions",
+			options: []TemplateOption{
+				TemplateData(map[string]int{"Count": 2}),
+				TemplateFuncs(template.FuncMap{"double": func(n int) int { return n * 2 }}),
+			},
+			input:  `{{double .Count}}`,
+			expect: "4",
+		},
+		{
+			name:    "missing key",
+			options: []TemplateOption{TemplateData(map[string]int{})},
+			input:   `{{.Count}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid range",
+			input:   `{{int 2 1}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			o := templateOptions{}
+			for _, option := range tt.options {
+				option(&o)
+			}
+
+			r, err := o.execute(strings.NewReader(tt.input))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			got, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(got))
+		})
+	}
+}
+
+func Test_templateOptions_seed(t *testing.T) {
+	const input = `{{uuid}} {{name}} {{email}} {{username}} {{int 1 100}} {{float 0 1}} {{bool}} {{pick "a" "b" "c"}} {{randomDate (date "2006" "2000") (date "2006" "2020")}}`
+
+	run := func(seed int64) string {
+		o := templateOptions{seed: seed, seeded: true}
+		r, err := o.execute(strings.NewReader(input))
+		assert.Nil(t, err)
+		got, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		return string(got)
+	}
+
+	first := run(42)
+	assert.Equal(t, first, run(42))
+	assert.NotEqual(t, first, run(43))
+
+	var o templateOptions
+	r, err := o.execute(strings.NewReader(input))
+	assert.Nil(t, err)
+	second, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	r, err = o.execute(strings.NewReader(input))
+	assert.Nil(t, err)
+	third, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.NotEqual(t, string(second), string(third), "seed should be chosen on every run")
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12} `, first)
+}
+
+func TestTemplates(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	random := New(SQLiteEngine(db), Templates())
+	first, err := random.Plan(strings.NewReader(`users: [{name: "{{uuid}}"}]`))
+	assert.Nil(t, err)
+	second, err := random.Plan(strings.NewReader(`users: [{name: "{{uuid}}"}]`))
+	assert.Nil(t, err)
+	assert.NotEqual(t, first[0].Args, second[0].Args)
+
+	p := New(SQLiteEngine(db), Templates(TemplateSeed(1)))
+
+	_, err = p.Plan(strings.NewReader(`users: {{unknown}}`))
+	assert.NotNil(t, err, "unknown function should fail")
+
+	err = p.Pollute(strings.NewReader(`users:
+{{- range times 3 }}
+- id: {{seq "users"}}
+  name: {{name}}
+{{- end }}
+`))
+	assert.Nil(t, err)
+
+	var sum int
+	err = db.QueryRow(`SELECT sum(id) FROM users`).Scan(&sum)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, sum)
+}
@@ -0,0 +1,112 @@
+package polluter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+type tomlParser struct{}
+
+// Parse builds the document from TOML keeping the
+// order keys are given in. Arrays of tables are
+// records of tables, offset datetimes are times and
+// local dates and datetimes are times in UTC.
+func (p tomlParser) Parse(r io.Reader) (jwalk.ObjectWalker, error) {
+	var v map[string]interface{}
+	md, err := toml.NewDecoder(r).Decode(&v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse")
+	}
+
+	doc := tomlValue(v, "", tomlOrder(md))
+	return walkable(doc).(docObject), nil
+}
+
+// tomlOrder returns positions of keys in the input.
+// Paths of keys are joined with \x00, elements of
+// arrays of tables are marked with \x01 and index.
+func tomlOrder(md toml.MetaData) map[string]int {
+	order := make(map[string]int)
+	counts := make(map[string]int)
+	for i, key := range md.Keys() {
+		var path string
+		for j, name := range key {
+			path = tomlPath(path, name)
+			if _, ok := order[path]; !ok {
+				order[path] = i
+			}
+			if md.Type(key[:j+1]...) != "ArrayHash" {
+				continue
+			}
+			if j == len(key)-1 {
+				counts[path]++
+			}
+			path = tomlIndex(path, counts[path]-1)
+		}
+	}
+	return order
+}
+
+func tomlPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "\x00" + name
+}
+
+func tomlIndex(path string, i int) string {
+	return fmt.Sprintf("%s\x01%d", path, i)
+}
+
+// tomlValue returns the native value with tables
+// as documents with keys in the order of the input.
+func tomlValue(v interface{}, path string, order map[string]int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, aok := order[tomlPath(path, keys[i])]
+			b, bok := order[tomlPath(path, keys[j])]
+			if aok != bok || a == b {
+				return aok || (aok == bok && keys[i] < keys[j])
+			}
+			return a < b
+		})
+
+		doc := make(Document, len(keys))
+		for i, key := range keys {
+			doc[i] = KeyValue{key, tomlValue(v[key], tomlPath(path, key), order)}
+		}
+		return doc
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, m := range v {
+			items[i] = tomlValue(m, tomlIndex(path, i), order)
+		}
+		return items
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = tomlValue(item, path, order)
+		}
+		return items
+	case time.Time:
+		// local values are given in zones named by their kind.
+		switch v.Location().String() {
+		case "datetime-local", "date-local":
+			return time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC)
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		}
+	}
+	return v
+}
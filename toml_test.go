@@ -0,0 +1,147 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/romanyx/jwalk"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tomlParser_parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expect  string
+		wantErr string
+	}{
+		{
+			name: "arrays of tables",
+			input: `[[roles]]
+_ref = "admin"
+name = "Admin"
+
+[[users]]
+name = "Roman"
+role_id = { "$ref" = "admin.id" }
+active = true
+
+[[roles]]
+name = "User"
+
+[[users]]
+tags = ["a", "b"]
+name = "Dmitry"
+`,
+			expect: `{"roles":[{"_ref":"admin","name":"Admin"},{"name":"User"}],"users":[{"name":"Roman","role_id":{"$ref":"admin.id"},"active":true},{"tags":["a","b"],"name":"Dmitry"}]}`,
+		},
+		{
+			name: "order of keys",
+			input: `c = "c"
+b = "b"
+all = []
+
+[_conflict]
+users = "skip"
+roles = { strategy = "update", target = ["name"] }
+
+[[users]]
+z = 1
+a = { nested = { b = 2, a = 1 } }
+`,
+			expect: `{"c":"c","b":"b","all":[],"_conflict":{"users":"skip","roles":{"strategy":"update","target":["name"]}},"users":[{"z":1,"a":{"nested":{"b":2,"a":1}}}]}`,
+		},
+		{
+			name: "inline records",
+			input: `users = [
+  { id = 1, name = "Roman" },
+  { id = 2, name = "Dmitry" },
+]
+`,
+			expect: `{"users":[{"id":1,"name":"Roman"},{"id":2,"name":"Dmitry"}]}`,
+		},
+		{
+			name:   "empty input",
+			input:  "",
+			expect: `{}`,
+		},
+		{
+			name:    "invalid input",
+			input:   "[[users]]\nname = \n",
+			wantErr: "toml: line 3",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := tomlParser{}.Parse(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+
+			got, err := obj.MarshalJSON()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(got))
+		})
+	}
+}
+
+func Test_tomlParser_types(t *testing.T) {
+	obj, err := tomlParser{}.Parse(strings.NewReader(`[[users]]
+id = 9007199254740993
+score = 1.1
+created_at = 2019-01-02T03:04:05+03:00
+updated_at = 2019-01-02T03:04:05
+birthday = 1990-05-06
+alarm = 07:30:00
+active = false
+`))
+	assert.Nil(t, err)
+
+	got := make(map[string]interface{})
+	err = WalkRecords(obj, func(rec Record) error {
+		for _, f := range rec.Fields {
+			got[f.Name] = f.Value.(jwalk.Value).Interface()
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	created := got["created_at"].(time.Time)
+	delete(got, "created_at")
+	assert.True(t, created.Equal(time.Date(2019, 1, 2, 0, 4, 5, 0, time.UTC)))
+	assert.Equal(t, map[string]interface{}{
+		"id":         int64(9007199254740993),
+		"score":      1.1,
+		"updated_at": time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		"birthday":   time.Date(1990, 5, 6, 0, 0, 0, 0, time.UTC),
+		"alarm":      "07:30:00",
+		"active":     false,
+	}, got)
+}
+
+func TestTOMLParser(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	err := New(SQLiteEngine(db), TOMLParser).Pollute(strings.NewReader(`[[roles]]
+_ref = "admin"
+name = "Admin"
+
+[[users]]
+id = 1
+name = "Roman"
+role_id = { "$ref" = "admin.id" }
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countRows(t, db, "roles"))
+	assert.Equal(t, 1, countRows(t, db, "users"))
+}
@@ -0,0 +1,44 @@
+package polluter
+
+import "github.com/romanyx/jwalk"
+
+// tables returns names of tables mentioned in
+// the document, including tables with no records.
+func tables(obj jwalk.ObjectWalker) ([]string, error) {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	err := obj.Walk(func(key string, value interface{}) error {
+		if directives[key] || seen[key] {
+			return nil
+		}
+
+		switch v := value.(type) {
+		case jwalk.ObjectsWalker:
+			names = append(names, key)
+			seen[key] = true
+		case jwalk.Value:
+			if items, ok := v.Interface().([]interface{}); ok && len(items) == 0 {
+				names = append(names, key)
+				seen[key] = true
+			}
+		}
+		return nil
+	})
+
+	return names, err
+}
+
+// buildTruncate builds commands removing records
+// of tables mentioned in the document.
+func buildTruncate(d dialect, obj jwalk.ObjectWalker) (Commands, error) {
+	names, err := tables(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return Commands{}, nil
+	}
+
+	return d.truncate(names), nil
+}
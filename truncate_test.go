@@ -0,0 +1,100 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const truncateInput = `{"roles":[{"id":1,"name":"Admin","meta":{"key":"value"}}],"users":[{"id":1,"name":"Roman","role_id":1,"email":null}],"groups":[]}`
+
+func Test_buildTruncate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		expect  Commands
+	}{
+		{
+			name:    "postgres",
+			dialect: postgresEngine{},
+			expect: Commands{
+				Command{Query: `TRUNCATE "roles", "users", "groups" RESTART IDENTITY CASCADE;`},
+			},
+		},
+		{
+			name:    "mysql",
+			dialect: mysqlEngine{},
+			expect: Commands{
+				Command{Query: "SET @polluter_foreign_key_checks = @@FOREIGN_KEY_CHECKS;"},
+				Command{Query: "SET FOREIGN_KEY_CHECKS = 0;"},
+				Command{Query: "DELETE FROM `roles`;"},
+				Command{Query: "DELETE FROM `users`;"},
+				Command{Query: "DELETE FROM `groups`;"},
+				Command{Query: "SET FOREIGN_KEY_CHECKS = @polluter_foreign_key_checks, @polluter_foreign_key_checks = NULL;"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := jsonParser{}.Parse(strings.NewReader(truncateInput))
+			if err != nil {
+				assert.Nil(t, err)
+			}
+
+			got, err := buildTruncate(tt.dialect, obj)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func TestTruncateCleanup(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	if _, err := db.Exec(`INSERT INTO users (id, name) VALUES (10, 'Existing')`); err != nil {
+		t.Fatalf("insert user: %s", err)
+	}
+	if _, err := db.Exec(`INSERT INTO roles (id, name) VALUES (1, 'Admin')`); err != nil {
+		t.Fatalf("insert role: %s", err)
+	}
+
+	p := New(SQLiteEngine(db), Truncate, TrackCleanup)
+	err := p.Pollute(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, countRows(t, db, "users"))
+
+	cleaner := New(SQLiteEngine(db, OnConflict(ConflictSkip)), TrackCleanup)
+	err = cleaner.Pollute(strings.NewReader(`roles:
+- id: 1
+  name: Admin
+- _ref: user
+  name: User
+users:
+- id: 3
+  name: Alex
+  meta: '{"key":"value"}'
+  role_id: {$ref: user.id}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, countRows(t, db, "roles"))
+	assert.Equal(t, 3, countRows(t, db, "users"))
+
+	assert.Nil(t, cleaner.Cleanup())
+	assert.Equal(t, 1, countRows(t, db, "roles"), "existing record should be kept")
+	assert.Equal(t, 2, countRows(t, db, "users"))
+
+	assert.Nil(t, p.Cleanup())
+	assert.Equal(t, 0, countRows(t, db, "users"))
+
+	untracked := New(SQLiteEngine(db))
+	err = untracked.Pollute(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Empty(t, untracked.cleanup)
+	assert.EqualError(t, untracked.Cleanup(), "cleanup requires TrackCleanup option")
+}
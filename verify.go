@@ -0,0 +1,453 @@
+package polluter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// Verifier is implemented by engines which are
+// able to compare the document with a database.
+type Verifier interface {
+	Verify(context.Context, jwalk.ObjectWalker) (Diff, error)
+}
+
+// Diff is the difference between
+// the document and a database.
+type Diff struct {
+	// Missing are records of the document
+	// which aren't found in a database.
+	Missing []Row
+	// Extra are records of tables of the document
+	// which aren't matched by its records.
+	Extra []Row
+	// Mismatched are records found by primary
+	// key, or keys for Redis engine, which have
+	// different values.
+	Mismatched []Mismatch
+}
+
+// Row is a record of the table. Table is
+// a key for Redis engine, Values is nil then.
+type Row struct {
+	Table  string
+	Values Document
+}
+
+// Mismatch is a record with different values.
+// Key holds values of the primary key, it's nil
+// for Redis engine.
+type Mismatch struct {
+	Table  string
+	Key    Document
+	Fields []FieldDiff
+}
+
+// FieldDiff is a field with different values,
+// Name is a key for Redis engine.
+type FieldDiff struct {
+	Name     string
+	Expected interface{}
+	Actual   interface{}
+}
+
+// Empty reports whether the document
+// matches a database.
+func (d Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Mismatched) == 0
+}
+
+// String returns the difference
+// with a line for every record.
+func (d Diff) String() string {
+	var b strings.Builder
+	for _, r := range d.Missing {
+		fmt.Fprintf(&b, "missing %s %s\n", r.Table, formatDocument(r.Values))
+	}
+	for _, r := range d.Extra {
+		fmt.Fprintf(&b, "extra %s %s\n", r.Table, formatDocument(r.Values))
+	}
+	for _, m := range d.Mismatched {
+		fields := make([]string, len(m.Fields))
+		for i, f := range m.Fields {
+			fields[i] = fmt.Sprintf("%s expected %s, got %s", f.Name, formatDiffValue(f.Expected), formatDiffValue(f.Actual))
+		}
+		fmt.Fprintf(&b, "mismatched %s %s: %s\n", m.Table, formatDocument(m.Key), strings.Join(fields, ", "))
+	}
+	return b.String()
+}
+
+func formatDocument(doc Document) string {
+	if doc == nil {
+		return ""
+	}
+
+	fields := make([]string, len(doc))
+	for i, kv := range doc {
+		fields[i] = kv.Key + ": " + formatDiffValue(kv.Value)
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+func formatDiffValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return strconv.Quote(string(v))
+	case Document:
+		return formatDocument(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// Verify parses input from the reader and compares
+// records of the document with a database.
+func (p *Polluter) Verify(r io.Reader) (Diff, error) {
+	return p.VerifyContext(context.Background(), r)
+}
+
+// VerifyContext is like Verify but stops
+// reading records when the context is done.
+func (p *Polluter) VerifyContext(ctx context.Context, r io.Reader) (Diff, error) {
+	v, ok := p.engine.(Verifier)
+	if !ok {
+		return Diff{}, errors.Wrap(ErrNotSupported, "verify")
+	}
+
+	obj, err := p.parse(ctx, r)
+	if err != nil {
+		return Diff{}, contextError(ctx, err)
+	}
+
+	diff, err := v.Verify(ctx, obj)
+	if err != nil {
+		return Diff{}, contextError(ctx, errors.Wrap(err, "verify failed"))
+	}
+	return diff, nil
+}
+
+// tableRows holds all records of the table,
+// used marks records matched by the document.
+type tableRows struct {
+	columns []string
+	types   []string
+	index   map[string]int
+	rows    [][]interface{}
+	used    []bool
+}
+
+// values returns the record as the document.
+func (t *tableRows) values(i int) Document {
+	doc := make(Document, len(t.columns))
+	for j, column := range t.columns {
+		v, err := exportValue(t.rows[i][j], t.types[j])
+		if err != nil {
+			v = t.rows[i][j]
+		}
+		doc[j] = KeyValue{column, v}
+	}
+	return doc
+}
+
+// match reports whether the record has
+// the same values of the fields.
+func (t *tableRows) match(i int, fields Document) bool {
+	for _, f := range fields {
+		j, ok := t.index[f.Key]
+		if !ok || !equalValues(f.Value, t.rows[i][j]) {
+			return false
+		}
+	}
+	return true
+}
+
+func loadRows(ctx context.Context, d dialect, conn SQLConn, table string) (*tableRows, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s", d.quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.Wrap(err, "columns")
+	}
+
+	t := tableRows{
+		columns: make([]string, len(types)),
+		types:   make([]string, len(types)),
+		index:   make(map[string]int, len(types)),
+	}
+	for i, typ := range types {
+		t.columns[i] = typ.Name()
+		t.types[i] = typ.DatabaseTypeName()
+		t.index[typ.Name()] = i
+	}
+
+	for rows.Next() {
+		dest := make([]interface{}, len(types))
+		for i := range dest {
+			dest[i] = new(interface{})
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+
+		row := make([]interface{}, len(dest))
+		for i := range dest {
+			row[i] = *(dest[i].(*interface{}))
+		}
+		t.rows = append(t.rows, row)
+		t.used = append(t.used, false)
+	}
+
+	return &t, rows.Err()
+}
+
+// verifySQL matches records of the document with
+// records of tables. Records are found by primary
+// key if it's given, otherwise by all given fields.
+// References are resolved to values of matched
+// labelled records.
+func verifySQL(ctx context.Context, d dialect, conn SQLConn, obj jwalk.ObjectWalker) (Diff, error) {
+	if conn == nil {
+		return Diff{}, errors.New("database isn't set")
+	}
+
+	var (
+		diff     Diff
+		names    []string
+		tables   = make(map[string]*tableRows)
+		keys     = make(map[string][]string)
+		labelled = make(map[string]Document)
+	)
+
+	if err := WalkRecords(obj, func(rec Record) error {
+		t, ok := tables[rec.Table]
+		if !ok {
+			var err error
+			if t, err = loadRows(ctx, d, conn, rec.Table); err != nil {
+				return errors.Wrap(err, rec.Table)
+			}
+			if keys[rec.Table], err = d.primaryKey(rec.Table); err != nil {
+				return errors.Wrapf(err, "%s: primary key", rec.Table)
+			}
+			tables[rec.Table] = t
+			names = append(names, rec.Table)
+		}
+
+		fields := make(Document, 0, len(rec.Fields))
+		for _, f := range rec.Fields {
+			if ref, ok := f.Value.(Ref); ok {
+				if v, ok := lookup(labelled[ref.Label], ref.Column); ok {
+					fields = append(fields, KeyValue{f.Name, v})
+				}
+				continue
+			}
+
+			v, err := jsonArg(f.Value, sqlOptions{})
+			if err == errSkipField {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "%s.%s", rec.Table, f.Name)
+			}
+			fields = append(fields, KeyValue{f.Name, v})
+		}
+
+		i, mismatch := findRow(t, keys[rec.Table], fields)
+		switch {
+		case i < 0:
+			diff.Missing = append(diff.Missing, Row{rec.Table, fields})
+			return nil
+		case mismatch != nil:
+			mismatch.Table = rec.Table
+			diff.Mismatched = append(diff.Mismatched, *mismatch)
+		}
+
+		t.used[i] = true
+		if rec.Label != "" {
+			labelled[rec.Label] = t.values(i)
+		}
+		return nil
+	}); err != nil {
+		return Diff{}, err
+	}
+
+	for _, name := range names {
+		t := tables[name]
+		for i := range t.rows {
+			if !t.used[i] {
+				diff.Extra = append(diff.Extra, Row{name, t.values(i)})
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// findRow returns index of the unused record matching
+// the fields, or -1. If the record is found by the
+// primary key it may have different values, which
+// are returned as the mismatch.
+func findRow(t *tableRows, pk []string, fields Document) (int, *Mismatch) {
+	key := make(Document, 0, len(pk))
+	for _, column := range pk {
+		v, ok := lookup(fields, column)
+		if !ok {
+			key = nil
+			break
+		}
+		key = append(key, KeyValue{column, v})
+	}
+
+	for i := range t.rows {
+		if t.used[i] {
+			continue
+		}
+		if len(key) == 0 {
+			if t.match(i, fields) {
+				return i, nil
+			}
+			continue
+		}
+		if !t.match(i, key) {
+			continue
+		}
+
+		var diffs []FieldDiff
+		for _, f := range fields {
+			j, ok := t.index[f.Key]
+			if !ok {
+				diffs = append(diffs, FieldDiff{Name: f.Key, Expected: f.Value})
+				continue
+			}
+			if !equalValues(f.Value, t.rows[i][j]) {
+				actual, _ := exportValue(t.rows[i][j], "")
+				diffs = append(diffs, FieldDiff{Name: f.Key, Expected: f.Value, Actual: actual})
+			}
+		}
+		if len(diffs) == 0 {
+			return i, nil
+		}
+		return i, &Mismatch{Key: key, Fields: diffs}
+	}
+
+	return -1, nil
+}
+
+func lookup(doc Document, key string) (interface{}, bool) {
+	for _, kv := range doc {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// timeLayouts are layouts of expected times
+// compared with time values of a database.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// equalValues compares the value of the document
+// with the value of a database, which may have
+// a different type for the same value.
+func equalValues(expected, actual interface{}) bool {
+	if b, ok := actual.([]byte); ok {
+		actual = string(b)
+	}
+
+	switch e := expected.(type) {
+	case nil:
+		return actual == nil
+	case bool:
+		switch a := actual.(type) {
+		case bool:
+			return a == e
+		case string:
+			b, err := strconv.ParseBool(a)
+			return err == nil && b == e
+		}
+		n, ok := toFloat(actual)
+		return ok && (n != 0) == e
+	case float64, int, int64, uint64:
+		n, ok := toFloat(actual)
+		m, _ := toFloat(e)
+		return ok && n == m
+	case string:
+		switch a := actual.(type) {
+		case string:
+			return a == e || equalJSON(e, a)
+		case time.Time:
+			for _, layout := range timeLayouts {
+				if t, err := time.Parse(layout, e); err == nil {
+					return t.Equal(a)
+				}
+			}
+			return false
+		}
+		n, ok := toFloat(actual)
+		m, err := strconv.ParseFloat(e, 64)
+		return ok && err == nil && n == m
+	case []byte:
+		a, ok := actual.(string)
+		return ok && a == string(e)
+	case time.Time:
+		switch a := actual.(type) {
+		case time.Time:
+			return a.Equal(e)
+		case string:
+			return equalValues(a, e)
+		}
+		return false
+	}
+
+	return reflect.DeepEqual(expected, actual)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// equalJSON compares JSON objects or
+// arrays regardless of formatting.
+func equalJSON(expected, actual string) bool {
+	if !strings.HasPrefix(expected, "{") && !strings.HasPrefix(expected, "[") {
+		return false
+	}
+
+	var e, a interface{}
+	if json.Unmarshal([]byte(expected), &e) != nil || json.Unmarshal([]byte(actual), &a) != nil {
+		return false
+	}
+	return reflect.DeepEqual(e, a)
+}
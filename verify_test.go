@@ -0,0 +1,114 @@
+package polluter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_equalValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected interface{}
+		actual   interface{}
+		expect   bool
+	}{
+		{name: "null", expected: nil, actual: nil, expect: true},
+		{name: "null and value", expected: nil, actual: int64(0), expect: false},
+		{name: "number and integer", expected: float64(1), actual: int64(1), expect: true},
+		{name: "number and numeric", expected: 1.5, actual: []byte("1.50"), expect: true},
+		{name: "bool and integer", expected: true, actual: int64(1), expect: true},
+		{name: "bool and bool", expected: false, actual: true, expect: false},
+		{name: "string and bytes", expected: "Roman", actual: []byte("Roman"), expect: true},
+		{name: "json", expected: `{"a":1,"b":[1,2]}`, actual: `{"b": [1, 2], "a": 1}`, expect: true},
+		{name: "not json", expected: `a`, actual: `b`, expect: false},
+		{name: "date", expected: "2019-01-02", actual: time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC), expect: true},
+		{name: "time", expected: "2019-01-02T03:04:05Z", actual: time.Date(2019, 1, 2, 3, 4, 6, 0, time.UTC), expect: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.expect, equalValues(tt.expected, tt.actual))
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	db, teardown := prepareSQLiteDB(t)
+	defer teardown()
+
+	err := New(SQLiteEngine(db)).Pollute(strings.NewReader(`roles:
+- id: 1
+  name: Admin
+- id: 2
+  name: User
+users:
+- id: 1
+  name: Roman
+  active: true
+  role_id: 1
+- id: 2
+  name: Dmitry
+  role_id: 2
+`))
+	assert.Nil(t, err)
+
+	p := New(SQLiteEngine(db))
+
+	diff, err := p.Verify(strings.NewReader(`roles:
+- _ref: admin
+  name: Admin
+- id: 2
+  name: User
+users:
+- id: 1
+  name: Roman
+  active: true
+  role_id: {$ref: admin.id}
+- id: 2
+  name: Dmitry
+`))
+	assert.Nil(t, err)
+	assert.True(t, diff.Empty(), diff.String())
+
+	diff, err = p.Verify(strings.NewReader(`roles:
+- id: 1
+  name: Root
+users:
+- id: 3
+  name: Alex
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, Diff{
+		Missing: []Row{
+			{"users", Document{{"id", int64(3)}, {"name", "Alex"}}},
+		},
+		Extra: []Row{
+			{"roles", Document{{"id", int64(2)}, {"name", "User"}}},
+			{"users", Document{{"id", int64(1)}, {"name", "Roman"}, {"active", true}, {"meta", nil}, {"role_id", int64(1)}}},
+			{"users", Document{{"id", int64(2)}, {"name", "Dmitry"}, {"active", false}, {"meta", nil}, {"role_id", int64(2)}}},
+		},
+		Mismatched: []Mismatch{
+			{
+				Table:  "roles",
+				Key:    Document{{"id", int64(1)}},
+				Fields: []FieldDiff{{Name: "name", Expected: "Root", Actual: "Admin"}},
+			},
+		},
+	}, diff)
+	assert.Equal(t, `missing users {id: 3, name: "Alex"}
+extra roles {id: 2, name: "User"}
+extra users {id: 1, name: "Roman", active: true, meta: null, role_id: 1}
+extra users {id: 2, name: "Dmitry", active: false, meta: null, role_id: 2}
+mismatched roles {id: 1}: name expected "Root", got "Admin"
+`, diff.String())
+
+	_, err = New(WithEngine(engineFunc(nil))).Verify(strings.NewReader(input))
+	assert.Equal(t, ErrNotSupported, pkgerrors.Cause(err))
+}
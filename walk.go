@@ -0,0 +1,260 @@
+package polluter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/romanyx/jwalk"
+)
+
+// docObject is the object of the document built by
+// parsers which don't produce JSON. It keeps the order
+// of fields and repeated names.
+type docObject []docField
+
+type docField struct {
+	name  string
+	value interface{}
+}
+
+func (o docObject) Walk(fn func(name string, value interface{}) error) error {
+	for _, f := range o {
+		if err := fn(f.name, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o docObject) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		data, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, errors.Wrap(err, f.name)
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// walkable converts the native value to the value of
+// the document: documents to objects, non-empty arrays
+// of documents to objects and the rest to values.
+func walkable(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Document:
+		obj := make(docObject, len(v))
+		for i, kv := range v {
+			obj[i] = docField{kv.Key, walkable(kv.Value)}
+		}
+		return obj
+	case []interface{}:
+		objs := make(docObjects, 0, len(v))
+		for _, item := range v {
+			doc, ok := item.(Document)
+			if !ok {
+				return docValue{v}
+			}
+			objs = append(objs, walkable(doc).(docObject))
+		}
+		if len(objs) > 0 {
+			return objs
+		}
+	}
+	return docValue{v}
+}
+
+// nativeValue converts the value of the document back to
+// the native value, values of documents built by parsers
+// which don't produce JSON are kept as is.
+func nativeValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case docValue:
+		return v.v, nil
+	case jwalk.ObjectWalker:
+		doc := make(Document, 0)
+		err := v.Walk(func(name string, value interface{}) error {
+			value, err := nativeValue(value)
+			if err != nil {
+				return errors.Wrap(err, name)
+			}
+			doc = append(doc, KeyValue{name, value})
+			return nil
+		})
+		return doc, err
+	case jwalk.ObjectsWalker:
+		items := make([]interface{}, 0)
+		err := v.Walk(func(obj jwalk.ObjectWalker) error {
+			item, err := nativeValue(obj)
+			items = append(items, item)
+			return err
+		})
+		return items, err
+	case json.Marshaler:
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return decodeJSON(data)
+	}
+	return v, nil
+}
+
+// docObjects is the array of objects of the document.
+type docObjects []jwalk.ObjectWalker
+
+func (o docObjects) Walk(fn func(obj jwalk.ObjectWalker) error) error {
+	for _, obj := range o {
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o docObjects) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('[')
+	for i, obj := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// docValue is the scalar or the array of the document
+// holding its native value: nil, bool, int64, uint64,
+// float64, string, time.Time, []byte, or []interface{}
+// and Document of them.
+type docValue struct {
+	v interface{}
+}
+
+func (v docValue) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := encodeJSON(buf, v.v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Interface returns the native value, nested
+// documents are returned as maps like jwalk does.
+func (v docValue) Interface() interface{} {
+	return plainValue(v.v)
+}
+
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Document:
+		m := make(map[string]interface{}, len(v))
+		for _, kv := range v {
+			m[kv.Key] = plainValue(kv.Value)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = plainValue(item)
+		}
+		return items
+	}
+	return v
+}
+
+func (v docValue) Bytes() []byte {
+	switch b := v.v.(type) {
+	case []byte:
+		return b
+	case nil:
+		return nil
+	}
+	return []byte(v.String())
+}
+
+func (v docValue) String() string {
+	switch s := v.v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case time.Time:
+		return s.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(s, 'g', -1, 64)
+	}
+	return fmt.Sprint(v.v)
+}
+
+func (v docValue) Int64() int64 {
+	switch n := v.v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func (v docValue) Uint64() uint64 {
+	if n, ok := v.v.(uint64); ok {
+		return n
+	}
+	return uint64(v.Int64())
+}
+
+func (v docValue) Float64() float64 {
+	switch n := v.v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+func (v docValue) Int8() int8       { return int8(v.Int64()) }
+func (v docValue) Int16() int16     { return int16(v.Int64()) }
+func (v docValue) Int32() int32     { return int32(v.Int64()) }
+func (v docValue) Int() int         { return int(v.Int64()) }
+func (v docValue) Uint() uint       { return uint(v.Uint64()) }
+func (v docValue) Uint8() uint8     { return uint8(v.Uint64()) }
+func (v docValue) Uint16() uint16   { return uint16(v.Uint64()) }
+func (v docValue) Uint32() uint32   { return uint32(v.Uint64()) }
+func (v docValue) Float32() float32 { return float32(v.Float64()) }
@@ -1,116 +1,349 @@
 package polluter
 
 import (
-	"bytes"
-	"fmt"
+	"encoding/base64"
 	"io"
-	"io/ioutil"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/romanyx/jwalk"
-	yaml "gopkg.in/yaml.v2"
+	yaml "gopkg.in/yaml.v3"
 )
 
+// refTag marks scalar as a reference
+// to the labelled record.
+const refTag = "!ref"
+
 type yamlParser struct{}
 
-func (p yamlParser) parse(r io.Reader) (jwalk.ObjectWalker, error) {
-	data, err := ioutil.ReadAll(r)
+// Parse builds the document from the YAML node tree
+// keeping native types of scalars: integers, floats,
+// timestamps, nulls and !!binary values. Documents of
+// the stream separated with --- are seeded in order,
+// as if their keys were given in a single document.
+func (p yamlParser) Parse(r io.Reader) (jwalk.ObjectWalker, error) {
+	dec := yaml.NewDecoder(r)
+
+	docs := make([]jwalk.ObjectWalker, 0, 1)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal failed")
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		root := resolveAlias(doc.Content[0])
+		if root.Kind == yaml.ScalarNode && root.ShortTag() == "!!null" {
+			continue
+		}
+		if root.Kind != yaml.MappingNode {
+			return nil, nodeError(root, "unexpected format, expected mapping")
+		}
+
+		obj, err := yamlObject(root, yamlPath{})
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, obj)
+	}
+
+	return joinDocuments(docs)
+}
+
+// Encode writes the document as YAML keeping
+// the order of keys, binary values are tagged
+// with !!binary.
+func (p yamlParser) Encode(w io.Writer, doc Document) error {
+	node, err := yamlNode(doc)
 	if err != nil {
-		return nil, errors.Wrap(err, "read from input")
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return errors.Wrap(err, "encode")
+	}
+	return enc.Close()
+}
+
+func yamlNode(v interface{}) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case Document:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, kv := range v {
+			value, err := yamlNode(kv.Value)
+			if err != nil {
+				return nil, errors.Wrap(err, kv.Key)
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv.Key}, value)
+		}
+		return n, nil
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			value, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, value)
+		}
+		return n, nil
+	case []byte:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!binary", Value: base64.StdEncoding.EncodeToString(v)}, nil
+	}
+
+	n := new(yaml.Node)
+	if err := n.Encode(v); err != nil {
+		return nil, err
 	}
+	return n, nil
+}
+
+// yamlPath is the set of nodes being expanded, an
+// alias to one of them makes a cycle.
+type yamlPath map[*yaml.Node]bool
+
+// enter resolves the alias and adds the node
+// to the path, the caller removes it with leave.
+func (p yamlPath) enter(node *yaml.Node) (*yaml.Node, error) {
+	target := resolveAlias(node)
+	if p[target] {
+		return nil, nodeError(node, "alias cycle")
+	}
+	p[target] = true
+	return target, nil
+}
 
-	j, err := yamlToJSON(data)
+func (p yamlPath) leave(node *yaml.Node) {
+	delete(p, node)
+}
+
+// yamlObject builds the object of the mapping.
+func yamlObject(node *yaml.Node, path yamlPath) (docObject, error) {
+	node, err := path.enter(node)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed convert to json")
+		return nil, err
 	}
+	defer path.leave(node)
 
-	i, err := jwalk.Parse(j)
+	items, err := mappingItems(node, path)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse")
+		return nil, err
 	}
 
-	obj, ok := i.(jwalk.ObjectWalker)
-	if !ok {
-		return nil, errors.New("unexpected format")
+	obj := make(docObject, 0, len(items))
+	for _, item := range items {
+		value, err := yamlWalkable(item[1], path)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, docField{item[0].Value, value})
 	}
 
 	return obj, nil
 }
 
-func yamlToJSON(data []byte) ([]byte, error) {
-	mapSlice := yaml.MapSlice{}
+// yamlWalkable builds the walkable value of the node:
+// an object for mappings and references, objects for
+// sequences of mappings and a value for the rest.
+func yamlWalkable(node *yaml.Node, path yamlPath) (interface{}, error) {
+	target := resolveAlias(node)
 
-	err := yaml.Unmarshal(data, &mapSlice)
-	if err != nil {
-		return nil, errors.Wrap(err, "unmarshal failed")
+	switch target.Kind {
+	case yaml.MappingNode:
+		return yamlObject(node, path)
+	case yaml.SequenceNode:
+		if len(target.Content) == 0 || !allMappings(target.Content) {
+			break
+		}
+		target, err := path.enter(node)
+		if err != nil {
+			return nil, err
+		}
+		defer path.leave(target)
+
+		objs := make(docObjects, 0, len(target.Content))
+		for _, n := range target.Content {
+			obj, err := yamlObject(n, path)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, obj)
+		}
+		return objs, nil
+	case yaml.ScalarNode:
+		if target.Tag == refTag {
+			return docObject{{refKey, docValue{target.Value}}}, nil
+		}
 	}
 
-	buf := new(bytes.Buffer)
-	handleMapSlice(mapSlice, buf)
+	v, err := yamlValue(node, path)
+	if err != nil {
+		return nil, err
+	}
+	return docValue{v}, nil
+}
 
-	return buf.Bytes(), nil
+func allMappings(nodes []*yaml.Node) bool {
+	for _, n := range nodes {
+		if resolveAlias(n).Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
 }
 
-func handleMapSlice(mapSlice yaml.MapSlice, buf *bytes.Buffer) {
-	buf.WriteString("{")
-	first := true
-	indent := ""
-	for _, item := range mapSlice {
-		buf.WriteString(indent + "\"" + item.Key.(string) + "\"" + ":")
-		switch v := item.Value.(type) {
-		case yaml.MapSlice:
-			handleMapSlice(v, buf)
-		case []interface{}:
-			buf.WriteString("[")
-			first := true
-			indent := ""
-			for _, i := range v {
-				switch v := i.(type) {
-				case yaml.MapSlice:
-					buf.WriteString(indent)
-					handleMapSlice(v, buf)
-				default:
-					buf.WriteString(indent + formatValue(v))
-				}
-				if first {
-					first = false
-					indent = ","
-				}
+// yamlValue returns the native value of the node,
+// mappings are returned as documents.
+func yamlValue(node *yaml.Node, path yamlPath) (interface{}, error) {
+	node, err := path.enter(node)
+	if err != nil {
+		return nil, err
+	}
+	defer path.leave(node)
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		items, err := mappingItems(node, path)
+		if err != nil {
+			return nil, err
+		}
+		doc := make(Document, 0, len(items))
+		for _, item := range items {
+			v, err := yamlValue(item[1], path)
+			if err != nil {
+				return nil, err
+			}
+			doc = append(doc, KeyValue{item[0].Value, v})
+		}
+		return doc, nil
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(node.Content))
+		for _, n := range node.Content {
+			v, err := yamlValue(n, path)
+			if err != nil {
+				return nil, err
 			}
-			buf.WriteString("]")
-		default:
-			buf.WriteString(formatValue(v))
+			items = append(items, v)
+		}
+		return items, nil
+	case yaml.ScalarNode:
+		return yamlScalar(node)
+	}
+
+	return nil, nodeError(node, "unexpected node")
+}
+
+// yamlScalar decodes the scalar by its tag, integers
+// are int64 or uint64 if they don't fit, unknown tags
+// keep the string.
+func yamlScalar(node *yaml.Node) (interface{}, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := node.Decode(&b)
+		return b, wrapNodeError(node, err)
+	case "!!int":
+		var i int64
+		if err := node.Decode(&i); err == nil {
+			return i, nil
+		}
+		var u uint64
+		err := node.Decode(&u)
+		return u, wrapNodeError(node, err)
+	case "!!float":
+		var f float64
+		err := node.Decode(&f)
+		return f, wrapNodeError(node, err)
+	case "!!timestamp":
+		var t time.Time
+		err := node.Decode(&t)
+		return t, wrapNodeError(node, err)
+	case "!!binary":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(node.Value), ""))
+		return b, wrapNodeError(node, err)
+	}
+
+	return node.Value, nil
+}
+
+func nodeError(node *yaml.Node, msg string) error {
+	return errors.Errorf("line %d, column %d: %s", node.Line, node.Column, msg)
+}
+
+func wrapNodeError(node *yaml.Node, err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.Wrapf(err, "line %d, column %d", node.Line, node.Column)
+}
+
+// mappingItems returns key and value pairs of
+// the mapping with merge keys expanded, keys
+// of the mapping itself override merged ones.
+func mappingItems(node *yaml.Node, path yamlPath) ([][2]*yaml.Node, error) {
+	items := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	explicit := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := resolveAlias(node.Content[i])
+		if key.Kind != yaml.ScalarNode {
+			return nil, nodeError(key, "key must be a scalar")
 		}
-		if first {
-			first = false
-			indent = ","
+		if key.ShortTag() != "!!merge" {
+			explicit[key.Value] = true
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := resolveAlias(node.Content[i]), node.Content[i+1]
+		if key.ShortTag() != "!!merge" {
+			items = append(items, [2]*yaml.Node{key, value})
+			continue
 		}
 
+		merged := []*yaml.Node{value}
+		if resolveAlias(value).Kind == yaml.SequenceNode {
+			merged = resolveAlias(value).Content
+		}
+		for _, m := range merged {
+			if resolveAlias(m).Kind != yaml.MappingNode {
+				return nil, nodeError(resolveAlias(m), "merged value must be a mapping")
+			}
+			m, err := path.enter(m)
+			if err != nil {
+				return nil, err
+			}
+			mitems, err := mappingItems(m, path)
+			path.leave(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range mitems {
+				if explicit[item[0].Value] {
+					continue
+				}
+				explicit[item[0].Value] = true
+				items = append(items, item)
+			}
+		}
 	}
-	buf.WriteString("}")
+
+	return items, nil
 }
 
-func formatValue(typedYAMLObj interface{}) string {
-	switch typedVal := typedYAMLObj.(type) {
-	case string:
-		return fmt.Sprintf("\"%s\"", typedVal)
-	case int:
-		return strconv.FormatInt(int64(typedVal), 10)
-	case int64:
-		return strconv.FormatInt(typedVal, 10)
-	case float64:
-		return strconv.FormatFloat(typedVal, 'g', -1, 32)
-	case uint64:
-		return strconv.FormatUint(typedVal, 10)
-	case bool:
-		if typedVal {
-			return "true"
-		}
-		return "false"
-	default:
-		return "null"
-	}
-
-	return ""
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
 }
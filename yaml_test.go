@@ -1,10 +1,13 @@
 package polluter
 
 import (
+	"bytes"
 	"io"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/romanyx/jwalk"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,6 +28,11 @@ func Test_yamlParser_parse(t *testing.T) {
 		order   []string
 		wantErr bool
 	}{
+		{
+			name:    "invalid input",
+			arg:     strings.NewReader("users: [1, 2"),
+			wantErr: true,
+		},
 		{
 			name: "valid input",
 			arg:  strings.NewReader(yamlInput),
@@ -43,7 +51,7 @@ func Test_yamlParser_parse(t *testing.T) {
 			t.Parallel()
 
 			p := yamlParser{}
-			w, err := p.parse(tt.arg)
+			w, err := p.Parse(tt.arg)
 
 			if tt.wantErr && err == nil {
 				assert.NotNil(t, err)
@@ -68,3 +76,224 @@ func Test_yamlParser_parse(t *testing.T) {
 		})
 	}
 }
+
+func Test_yamlParser_document(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expect  string
+		wantErr string
+	}{
+		{
+			name: "reference",
+			input: `users:
+- name: Roman
+  role_id: !ref admin.id
+`,
+			expect: `{"users":[{"name":"Roman","role_id":{"$ref":"admin.id"}}]}`,
+		},
+		{
+			name: "merge keys",
+			input: `defaults: &defaults
+  active: true
+  role_id: 1
+users:
+- <<: *defaults
+  name: Roman
+  role_id: 2
+`,
+			expect: `{"defaults":{"active":true,"role_id":1},"users":[{"active":true,"name":"Roman","role_id":2}]}`,
+		},
+		{
+			name: "escaped strings",
+			input: `users:
+- name: "Roman \"R\""
+  bio: |
+    first
+    second
+`,
+			expect: `{"users":[{"name":"Roman \"R\"","bio":"first\nsecond\n"}]}`,
+		},
+		{
+			name: "scalars",
+			input: `values:
+- int: 9007199254740993
+  float: 0.1
+  time: 2019-01-02T03:04:05Z
+  binary: !!binary /wA=
+  "null": ~
+  list: [1, a, {b: true}]
+  1: key
+`,
+			expect: `{"values":[{"int":9007199254740993,"float":0.1,"time":"2019-01-02T03:04:05Z","binary":"/wA=","null":null,"list":[1,"a",{"b":true}],"1":"key"}]}`,
+		},
+		{
+			name: "aliases",
+			input: `roles: &roles
+- &admin
+  name: Admin
+  tags: &tags [a, b]
+admins:
+- *admin
+- name: Root
+  tags: *tags
+copies: *roles
+`,
+			expect: `{"roles":[{"name":"Admin","tags":["a","b"]}],"admins":[{"name":"Admin","tags":["a","b"]},{"name":"Root","tags":["a","b"]}],"copies":[{"name":"Admin","tags":["a","b"]}]}`,
+		},
+		{
+			name: "merge list",
+			input: `users:
+- <<: [{active: true, role_id: 1}, {role_id: 2, meta: null}]
+  name: Roman
+`,
+			expect: `{"users":[{"active":true,"role_id":1,"meta":null,"name":"Roman"}]}`,
+		},
+		{
+			name: "multiple documents",
+			input: `roles:
+- name: Admin
+users:
+- name: Roman
+---
+# nothing to seed
+---
+users:
+- name: Dmitry
+_conflict:
+  users: skip
+`,
+			expect: `{"roles":[{"name":"Admin"}],"users":[{"name":"Roman"}],"users":[{"name":"Dmitry"}],"_conflict":{"users":"skip"}}`,
+		},
+		{
+			name:   "empty input",
+			input:  "",
+			expect: `{}`,
+		},
+		{
+			name:    "invalid document of stream",
+			input:   "users: []\n---\n- users\n",
+			wantErr: "line 3, column 1: unexpected format",
+		},
+		{
+			name:    "sequence key",
+			input:   "users:\n- [a]: b\n",
+			wantErr: "line 2, column 3: key must be a scalar",
+		},
+		{
+			name:    "invalid merge",
+			input:   "users:\n- <<: 1\n",
+			wantErr: "line 2, column 7: merged value must be a mapping",
+		},
+		{
+			name:    "alias cycle",
+			input:   "a: &x [*x]\n",
+			wantErr: "line 1, column 8: alias cycle",
+		},
+		{
+			name:    "indirect alias cycle",
+			input:   "users:\n- &user\n  name: Roman\n  friends: [*user]\n",
+			wantErr: "line 4, column 13: alias cycle",
+		},
+		{
+			name:    "merge cycle",
+			input:   "users:\n- &user\n  <<: *user\n",
+			wantErr: "line 3, column 7: alias cycle",
+		},
+		{
+			name:    "not a mapping",
+			input:   "- users\n",
+			wantErr: "line 1, column 1: unexpected format",
+		},
+		{
+			name:    "invalid binary",
+			input:   "users:\n- avatar: !!binary '%'\n",
+			wantErr: "line 2, column 11",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj, err := yamlParser{}.Parse(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+
+			got, err := obj.MarshalJSON()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expect, string(got))
+		})
+	}
+}
+
+func Test_yamlParser_types(t *testing.T) {
+	obj, err := yamlParser{}.Parse(strings.NewReader(`users:
+- id: 9007199254740993
+  score: 1.1
+  created_at: 2019-01-02 03:04:05
+  avatar: !!binary /wA=
+  email: null
+  active: true
+  name: "1"
+  big: 18446744073709551615
+`))
+	assert.Nil(t, err)
+
+	got := make(map[string]interface{})
+	err = WalkRecords(obj, func(rec Record) error {
+		for _, f := range rec.Fields {
+			got[f.Name] = f.Value.(jwalk.Value).Interface()
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":         int64(9007199254740993),
+		"score":      1.1,
+		"created_at": time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		"avatar":     []byte{0xff, 0x00},
+		"email":      nil,
+		"active":     true,
+		"name":       "1",
+		"big":        uint64(18446744073709551615),
+	}, got)
+}
+
+func Test_yamlParser_Encode(t *testing.T) {
+	doc := Document{
+		{"users", []interface{}{
+			Document{
+				{"id", int64(1)},
+				{"name", "true"},
+				{"score", 1.5},
+				{"avatar", []byte{0xff, 0x00}},
+				{"created_at", time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)},
+				{"meta", Document{{"tags", []interface{}{"a", "b"}}}},
+				{"email", nil},
+			},
+		}},
+	}
+
+	buf := new(bytes.Buffer)
+	err := yamlParser{}.Encode(buf, doc)
+	assert.Nil(t, err)
+	assert.Equal(t, `users:
+  - id: 1
+    name: "true"
+    score: 1.5
+    avatar: !!binary /wA=
+    created_at: 2019-01-02T03:04:05Z
+    meta:
+      tags:
+        - a
+        - b
+    email: null
+`, buf.String())
+}